@@ -0,0 +1,156 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Definition of the causes of an error.
+
+package derrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ForeignError structure that records a golang error that is not a derrors Error so it can be serialized.
+type ForeignError struct {
+	// TypeName contains the golang type of the original error.
+	TypeName string `json:"typeName"`
+	// Message contains the message of the original error.
+	Message string `json:"message"`
+	// err contains the original error. It is not serialized so it is only available on the process that created it.
+	err error
+}
+
+// NewForeignError creates a new ForeignError recording a golang error.
+func NewForeignError(err error) *ForeignError {
+	return &ForeignError{fmt.Sprintf("%T", err), err.Error(), err}
+}
+
+// Error returns the message of the original error.
+func (fe *ForeignError) Error() string {
+	return fe.Message
+}
+
+// Unwrap returns the original error if available.
+func (fe *ForeignError) Unwrap() error {
+	return fe.err
+}
+
+// String returns the string representation of a ForeignError.
+func (fe *ForeignError) String() string {
+	if fe.TypeName == "" {
+		return fe.Message
+	}
+	return fmt.Sprintf("%s (%s)", fe.Message, fe.TypeName)
+}
+
+// Cause structure that contains one of the causes of an error. Causes that are derrors errors are kept as nested
+// GenericError while any other error is recorded as a ForeignError. Errors wrapping a derrors Error set both fields,
+// the ForeignError recording the wrapping error and the GenericError the wrapped one.
+type Cause struct {
+	// Error contains the cause if it is, or wraps, a derrors error.
+	Error *GenericError `json:"error,omitempty"`
+	// Foreign contains the cause if it is any other golang error.
+	Foreign *ForeignError `json:"foreign,omitempty"`
+	// err contains the original error. It is not serialized so it is only available on the process that created it.
+	err error
+}
+
+// NewCause creates a new Cause from a golang error. Errors that are a derrors Error are kept as a nested
+// GenericError, errors wrapping a derrors Error also keep the nested GenericError.
+func NewCause(err error) *Cause {
+	if derror, ok := err.(Error); ok {
+		return &Cause{Error: ToGenericError(derror), err: err}
+	}
+	result := &Cause{Foreign: NewForeignError(err), err: err}
+	var derror Error
+	if errors.As(err, &derror) {
+		result.Error = ToGenericError(derror)
+	}
+	return result
+}
+
+// Err returns the cause as a golang error. The original error is returned if available, otherwise an equivalent
+// error is returned.
+func (c *Cause) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.Foreign != nil && c.Error != nil {
+		return &ForeignError{c.Foreign.TypeName, c.Foreign.Message, c.Error}
+	}
+	if c.Error != nil {
+		return c.Error
+	}
+	if c.Foreign != nil {
+		return c.Foreign
+	}
+	return nil
+}
+
+// withError returns a copy of the cause with a different nested GenericError. The original error is discarded if
+// it is the replaced GenericError.
+func (c Cause) withError(err *GenericError) Cause {
+	if c.Error != nil && c.err == error(c.Error) {
+		c.err = nil
+	}
+	c.Error = err
+	return c
+}
+
+// String returns the string representation of a Cause including the debug report of nested errors.
+func (c *Cause) String() string {
+	if c.Foreign != nil && c.Error != nil {
+		return fmt.Sprintf("%s wrapping %s", c.Foreign.String(), c.Error.DebugReport())
+	}
+	if c.Error != nil {
+		return c.Error.DebugReport()
+	}
+	if c.Foreign != nil {
+		return c.Foreign.String()
+	}
+	return ""
+}
+
+// UnmarshalJSON unmarshalls a cause. Previous versions serialized causes as plain strings, those are recovered as
+// ForeignError.
+func (c *Cause) UnmarshalJSON(data []byte) error {
+	var message string
+	if err := json.Unmarshal(data, &message); err == nil {
+		*c = Cause{Foreign: &ForeignError{Message: message}}
+		return nil
+	}
+	// Use an alias type to avoid calling UnmarshalJSON recursively.
+	type plainCause Cause
+	var result plainCause
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	*c = Cause(result)
+	return nil
+}
+
+// ErrorsToCauses transform a list of errors into a list of causes.
+func ErrorsToCauses(errors []error) []Cause {
+	result := make([]Cause, 0, len(errors))
+	for _, err := range errors {
+		if err != nil {
+			result = append(result, *NewCause(err))
+		}
+	}
+	return result
+}
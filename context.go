@@ -0,0 +1,100 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Metadata of the errors obtained from the context of the operation.
+
+package derrors
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// contextKeys contains the context keys whose values are copied to the metadata of the errors, indexed by the
+// name used in the metadata.
+var contextKeys = struct {
+	sync.RWMutex
+	keys map[string]interface{}
+}{keys: make(map[string]interface{})}
+
+// RegisterContextKey registers a context key whose value is copied with a given name to the metadata of the errors
+// created with NewErrorCtx. The values are formatted with fmt.Sprint.
+func RegisterContextKey(name string, key interface{}) {
+	contextKeys.Lock()
+	defer contextKeys.Unlock()
+	contextKeys.keys[name] = key
+}
+
+// ResetContextKeys removes all the context keys registered with RegisterContextKey.
+func ResetContextKeys() {
+	contextKeys.Lock()
+	defer contextKeys.Unlock()
+	contextKeys.keys = make(map[string]interface{})
+}
+
+// ContextMetadata returns the pprof labels of a context and the values of the registered context keys. The values
+// of the registered keys take precedence over the labels with the same name. It returns nil if the context has no
+// metadata.
+func ContextMetadata(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	result := make(map[string]string)
+	pprof.ForLabels(ctx, func(key string, value string) bool {
+		result[key] = value
+		return true
+	})
+	contextKeys.RLock()
+	for name, key := range contextKeys.keys {
+		if value := ctx.Value(key); value != nil {
+			result[name] = fmt.Sprint(value)
+		}
+	}
+	contextKeys.RUnlock()
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// NewErrorCtx creates a new GenericError with a given type copying the pprof labels and the values of the
+// registered context keys of the context into the metadata of the error.
+func NewErrorCtx(ctx context.Context, errorType ErrorType, msg string, causes ...error) *GenericError {
+	return newErrorCtx(ctx, 1, errorType, msg, causes)
+}
+
+// metadataToString returns the string representation of the metadata sorted by name.
+func (ge *GenericError) metadataToString() string {
+	if len(ge.Metadata) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(ge.Metadata))
+	for name := range ge.Metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buffer strings.Builder
+	buffer.WriteString("Metadata:\n")
+	for _, name := range names {
+		buffer.WriteString(name + ": " + ge.Metadata[name] + "\n")
+	}
+	return buffer.String()
+}
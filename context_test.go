@@ -0,0 +1,56 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Context metadata tests
+
+package derrors
+
+import (
+	"context"
+	"encoding/json"
+	"runtime/pprof"
+	"strings"
+	"testing"
+)
+
+type testContextKey string
+
+func TestNewErrorCtx(t *testing.T) {
+	defer ResetContextKeys()
+	RegisterContextKey("requestID", testContextKey("request"))
+	RegisterContextKey("user", testContextKey("user"))
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels("tenant", "acme", "kind", "batch"))
+	ctx = context.WithValue(ctx, testContextKey("request"), 42)
+
+	err := NewErrorCtx(ctx, Internal, "operation failed")
+	assertEquals(t, Internal, err.Type(), "expecting type")
+	assertEquals(t, map[string]string{"tenant": "acme", "kind": "batch", "requestID": "42"}, err.Metadata,
+		"expecting metadata")
+	assertTrue(t, strings.HasSuffix(err.StackTrace()[0].FunctionName, ".TestNewErrorCtx"), "expecting caller")
+	assertTrue(t, strings.Contains(err.DebugReport(), "Metadata:\nkind: batch\nrequestID: 42\ntenant: acme\n"),
+		"expecting sorted metadata in the report")
+
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertEquals(t, err.Metadata, recovered.(*GenericError).Metadata, "expecting serialized metadata")
+
+	empty := NewErrorCtx(context.Background(), Internal, "operation failed")
+	assertTrue(t, empty.Metadata == nil, "expecting no metadata")
+	assertTrue(t, !strings.Contains(empty.DebugReport(), "Metadata:"), "expecting no metadata in the report")
+}
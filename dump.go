@@ -0,0 +1,219 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Dump of the goroutines of the process attached to the errors.
+
+package derrors
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultDumpSize is the default maximum size in bytes of the goroutine dump read from the runtime.
+const DefaultDumpSize = 1 << 20
+
+// DefaultDumpGroups is the default maximum number of groups of goroutines kept in a dump.
+const DefaultDumpGroups = 64
+
+// DumpOptions structure that defines when a dump of all the goroutines is attached to an error and its limits.
+type DumpOptions struct {
+	// ErrorTypes contains the types of the errors that get the dump attached when they are created.
+	ErrorTypes []ErrorType
+	// MaxSize is the maximum size in bytes of the dump read from the runtime.
+	MaxSize int
+	// MaxGroups is the maximum number of groups of goroutines with the same stack kept in the dump.
+	MaxGroups int
+}
+
+// NewDumpOptions returns the options that attach a goroutine dump to the Internal and Aborted errors, as those
+// are usually related to deadlocks and unexpected states of the process.
+func NewDumpOptions() *DumpOptions {
+	return &DumpOptions{
+		ErrorTypes: []ErrorType{Internal, Aborted},
+		MaxSize:    DefaultDumpSize,
+		MaxGroups:  DefaultDumpGroups,
+	}
+}
+
+// dumpOptions contains the options of the goroutine dumps.
+var dumpOptions atomic.Value
+
+// SetDumpOptions sets the options of the goroutine dumps. Notice that a dump stops the world while the stacks of
+// all the goroutines are collected, so it should only be attached to errors that are rare. A nil value disables
+// attaching the dumps when the errors are created.
+func SetDumpOptions(options *DumpOptions) {
+	if options == nil {
+		options = &DumpOptions{}
+	}
+	copied := *options
+	copied.ErrorTypes = append([]ErrorType(nil), options.ErrorTypes...)
+	dumpOptions.Store(&copied)
+}
+
+// CurrentDumpOptions returns the options of the goroutine dumps.
+func CurrentDumpOptions() *DumpOptions {
+	if options, ok := dumpOptions.Load().(*DumpOptions); ok {
+		return options
+	}
+	return &DumpOptions{}
+}
+
+// dumpEnabled checks if a dump must be attached to a new error of a given type.
+func (do *DumpOptions) dumpEnabled(errorType ErrorType) bool {
+	for _, candidate := range do.ErrorTypes {
+		if candidate == errorType {
+			return true
+		}
+	}
+	return false
+}
+
+// GoroutineDump structure that contains the stacks of all the goroutines of the process grouped by identical
+// stacks.
+type GoroutineDump struct {
+	// Goroutines is the number of goroutines included in the dump.
+	Goroutines int `json:"goroutines"`
+	// Groups contains the goroutines grouped by state and stack.
+	Groups []GoroutineGroup `json:"groups"`
+	// Truncated indicates that the dump exceeded the size limits and some goroutines are missing.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// GoroutineGroup structure that contains a set of goroutines with the same state and stack.
+type GoroutineGroup struct {
+	// State of the goroutines such as running or chan receive.
+	State string `json:"state"`
+	// IDs of the goroutines of the group.
+	IDs []uint64 `json:"ids"`
+	// Stack shared by the goroutines.
+	Stack []StackEntry `json:"stack"`
+	// CreatedBy contains the go statement that started the goroutines.
+	CreatedBy *StackEntry `json:"createdBy,omitempty"`
+}
+
+// CaptureGoroutineDump returns a dump of all the goroutines of the process within the limits of the options. The
+// zero values of the limits are replaced by their defaults.
+func CaptureGoroutineDump(options *DumpOptions) *GoroutineDump {
+	maxSize := options.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultDumpSize
+	}
+	size := 64 * 1024
+	if size > maxSize {
+		size = maxSize
+	}
+	for {
+		buffer := make([]byte, size)
+		count := runtime.Stack(buffer, true)
+		if count < len(buffer) || size >= maxSize {
+			return ParseGoroutineDump(buffer[:count], count == len(buffer), options.MaxGroups)
+		}
+		size = 2 * size
+		if size > maxSize {
+			size = maxSize
+		}
+	}
+}
+
+// ParseGoroutineDump parses the stacks of all the goroutines as formatted by runtime.Stack, grouping the
+// goroutines with the same state and stack. If the dump is truncated, the last goroutine is discarded as its stack
+// is incomplete. A maxGroups of 0 uses DefaultDumpGroups.
+func ParseGoroutineDump(dump []byte, truncated bool, maxGroups int) *GoroutineDump {
+	if maxGroups <= 0 {
+		maxGroups = DefaultDumpGroups
+	}
+	result := &GoroutineDump{Groups: make([]GoroutineGroup, 0), Truncated: truncated}
+	blocks := strings.Split(string(bytes.TrimSpace(dump)), "\n\n")
+	if truncated && len(blocks) > 0 {
+		blocks = blocks[:len(blocks)-1]
+	}
+	groups := make(map[string]int)
+	for _, block := range blocks {
+		if !strings.HasPrefix(block, "goroutine ") {
+			continue
+		}
+		info, state, frames := parseGoroutine(strings.Split(block, "\n"))
+		group := GoroutineGroup{State: groupState(state), IDs: []uint64{info.ID}, Stack: frames, CreatedBy: info.CreatedBy}
+		key := group.key()
+		if index, exists := groups[key]; exists {
+			result.Groups[index].IDs = append(result.Groups[index].IDs, info.ID)
+		} else if len(result.Groups) < maxGroups {
+			groups[key] = len(result.Groups)
+			result.Groups = append(result.Groups, group)
+		} else {
+			result.Truncated = true
+			continue
+		}
+		result.Goroutines++
+	}
+	return result
+}
+
+// groupState removes the time a goroutine has been waiting from its state, so goroutines blocked at the same point
+// belong to the same group.
+func groupState(state string) string {
+	// chan receive, 5 minutes, locked to thread
+	parts := strings.Split(state, ", ")
+	result := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if !strings.HasSuffix(part, " minutes") {
+			result = append(result, part)
+		}
+	}
+	return strings.Join(result, ", ")
+}
+
+// key returns the value that identifies the goroutines with the same state and stack.
+func (gg *GoroutineGroup) key() string {
+	var buffer strings.Builder
+	buffer.WriteString(gg.State + "\n")
+	for _, entry := range gg.Stack {
+		buffer.WriteString(entry.String() + "\n")
+	}
+	if gg.CreatedBy != nil {
+		buffer.WriteString(gg.CreatedBy.String())
+	}
+	return buffer.String()
+}
+
+// String returns the string representation of a GoroutineDump.
+func (gd *GoroutineDump) String() string {
+	var buffer strings.Builder
+	buffer.WriteString(fmt.Sprintf("Goroutines: %d in %d groups", gd.Goroutines, len(gd.Groups)))
+	if gd.Truncated {
+		buffer.WriteString(" (truncated)")
+	}
+	buffer.WriteString("\n")
+	for _, group := range gd.Groups {
+		ids := make([]string, len(group.IDs))
+		for i, id := range group.IDs {
+			ids[i] = fmt.Sprintf("%d", id)
+		}
+		buffer.WriteString(fmt.Sprintf("%d goroutines [%s]: %s\n", len(group.IDs), group.State, strings.Join(ids, ", ")))
+		for _, entry := range group.Stack {
+			buffer.WriteString("\t" + entry.String() + "\n")
+		}
+		if group.CreatedBy != nil {
+			buffer.WriteString("\tcreated by " + group.CreatedBy.String() + "\n")
+		}
+	}
+	return buffer.String()
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Goroutine dump tests
+
+package derrors
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testDump = `goroutine 1 [running]:
+main.main()
+	/src/app/main.go:5 +0x1d
+
+goroutine 7 [chan receive, 5 minutes]:
+main.worker(0x1)
+	/src/app/main.go:12 +0x25
+created by main.startPool in goroutine 1
+	/src/app/pool.go:20 +0x45
+
+goroutine 8 [chan receive]:
+main.worker(0x2)
+	/src/app/main.go:12 +0x25
+created by main.startPool in goroutine 1
+	/src/app/pool.go:20 +0x45
+
+goroutine 9 [select]:
+main.monitor()
+	/src/app/monitor.go:30 +0x10
+`
+
+func TestParseGoroutineDump(t *testing.T) {
+	dump := ParseGoroutineDump([]byte(testDump), false, 0)
+	assertEquals(t, 4, dump.Goroutines, "expecting all goroutines")
+	assertEquals(t, 3, len(dump.Groups), "identical stacks must be grouped")
+	assertTrue(t, !dump.Truncated, "dump must not be truncated")
+	workers := dump.Groups[1]
+	assertEquals(t, "chan receive", workers.State, "expecting state without waiting time")
+	assertEquals(t, []uint64{7, 8}, workers.IDs, "expecting grouped goroutines")
+	assertEquals(t, []StackEntry{*NewStackEntry("main.worker", "/src/app/main.go", 12)}, workers.Stack,
+		"expecting stack")
+	assertEquals(t, NewStackEntry("main.startPool", "/src/app/pool.go", 20), workers.CreatedBy, "expecting creator")
+	assertTrue(t, strings.Contains(dump.String(), "2 goroutines [chan receive]: 7, 8\n"),
+		"expecting group in the string representation")
+
+	limited := ParseGoroutineDump([]byte(testDump), false, 2)
+	assertEquals(t, 2, len(limited.Groups), "expecting limited groups")
+	assertEquals(t, 3, limited.Goroutines, "goroutines out of the groups are discarded")
+	assertTrue(t, limited.Truncated, "dump must be truncated")
+
+	partial := ParseGoroutineDump([]byte(testDump[:len(testDump)-20]), true, 0)
+	assertEquals(t, 3, partial.Goroutines, "incomplete goroutine must be discarded")
+	assertTrue(t, partial.Truncated, "dump must be truncated")
+}
+
+func TestCaptureGoroutineDump(t *testing.T) {
+	assertTrue(t, NewInternalError("operation failed").Goroutines == nil, "dump must be disabled by default")
+	defer SetDumpOptions(nil)
+	SetDumpOptions(NewDumpOptions())
+	block := make(chan bool)
+	defer close(block)
+	for i := 0; i < 3; i++ {
+		go func() {
+			<-block
+		}()
+	}
+	err := NewAbortedError("deadlock detected")
+	assertTrue(t, err.Goroutines != nil, "expecting dump")
+	assertTrue(t, NewNotFoundError("entity not found").Goroutines == nil, "dump only attached to selected types")
+	blocked := 0
+	for _, group := range err.Goroutines.Groups {
+		if group.CreatedBy != nil && strings.HasSuffix(group.CreatedBy.FunctionName, ".TestCaptureGoroutineDump") {
+			blocked += len(group.IDs)
+		}
+	}
+	assertEquals(t, 3, blocked, "expecting blocked goroutines")
+	assertTrue(t, strings.Contains(err.DebugReport(), "Goroutines: "), "expecting dump in the report")
+
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertEquals(t, err.Goroutines, recovered.(*GenericError).Goroutines, "expecting serialized dump")
+
+	limited := NewGenericError("on demand")
+	SetDumpOptions(&DumpOptions{MaxSize: 1024})
+	limited = limited.WithGoroutineDump()
+	assertTrue(t, limited.Goroutines.Truncated, "expecting dump bounded by the options")
+}
@@ -19,72 +19,161 @@ package derrors
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
-	"runtime"
+	"sort"
+	"strings"
 )
 
-// StackEntry structure that contains information about an element in the calling stack.
-type StackEntry struct {
-	// FunctionName of the calling function.
-	FunctionName string
-	// File where the function is located.
-	File string
-	// Line of the file where the function is located.
-	Line int
-}
-
-// NewStackEntry creates a new stack entry for a function on a given file:line.
-func NewStackEntry(functionName string, file string, line int) *StackEntry {
-	return &StackEntry{functionName, file, line}
-}
-
-// String returns the string representation of an StackEntry.
-func (se *StackEntry) String() string {
-	return fmt.Sprintf("%s - %s:%d", se.FunctionName, se.File, se.Line)
-}
-
-// GenericError structure that defines the basic elements shared by all DaishoErrors.
+// GenericError structure that defines the basic elements shared by all DaishoErrors. The With methods and CausedBy
+// return a new error without modifying the receiver, so a GenericError can be shared and decorated concurrently as
+// long as its fields are not modified directly.
 type GenericError struct {
 	// ErrorType from the enumeration.
 	ErrorType ErrorType `json:"errorType"`
 	// Message contains the error message.
 	Message string `json:"message"`
+	// Instance contains a URI identifying the occurrence of the error. Errors created with the constructors only
+	// populate this field on demand, use InstanceID to access it.
+	Instance string `json:"instance,omitempty"`
 	// Parameters associated with error.
 	Parameters []string `json:"parameters"`
-	// causes contains the list of causes of the error.
-	Causes []string `json:"causes"`
+	// Fields contains the named parameters associated with the error as JSON values.
+	Fields map[string]json.RawMessage `json:"fields,omitempty"`
+	// Notes contains the problems found while recording the parameters and fields.
+	Notes []string `json:"notes,omitempty"`
+	// Metadata contains the pprof labels and registered context values of the operation that created the error.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Causes contains the list of causes of the error.
+	Causes []Cause `json:"causes"`
 	// Parent Daisho Error.
-	Parent interface{} `json:"parent"`
-	// stackTrace contains the calling stack trace.
+	Parent Error `json:"parent"`
+	// Stack contains the calling stack trace. Errors created with the constructors capture the calling stack
+	// and only populate this field on demand, use StackTrace to access it.
 	Stack []StackEntry `json:"stackTrace"`
-}
-
-// WithParams permits to track extra parameters in the operation error.
+	// RawStack contains the calling stack as program counters when the error was serialized with the
+	// ProgramCounterStack encoding. Use Symbolize to restore the stack trace.
+	RawStack *RawStack `json:"rawStack,omitempty"`
+	// Goroutine identifies the goroutine that created the error. It is only captured if enabled with
+	// SetCaptureGoroutine.
+	Goroutine *GoroutineInfo `json:"goroutine,omitempty"`
+	// Goroutines contains a dump of all the goroutines of the process. It is attached to the error types selected
+	// with SetDumpOptions or with WithGoroutineDump.
+	Goroutines *GoroutineDump `json:"goroutines,omitempty"`
+	// Resources contains a snapshot of the resources of the process. It is attached to the ResourceExhausted errors
+	// if enabled with SetCaptureResources.
+	Resources *ResourceSnapshot `json:"resources,omitempty"`
+	// callers contains the captured calling stack pending to be symbolized.
+	callers *callers
+	// instance contains the identifier of the occurrence pending to be generated.
+	instance *instanceID
+	// decodedFrames contains the number of frames shared with the parent recovered from the JSON representation.
+	decodedFrames *sharedFrames
+}
+
+// sharedFrames structure that records the number of frames a decoded error shares with its decoded parent.
+type sharedFrames struct {
+	// parent is the parent error decoded together with the error.
+	parent *GenericError
+	// count is the number of frames shared with the parent.
+	count int
+}
+
+// WithParams returns a copy of the error that tracks extra parameters in the operation error. Values that cannot be
+// marshalled or exceed ParameterSize are stored with a note describing the problem.
 func (ge *GenericError) WithParams(params ...interface{}) *GenericError {
+	result := ge.copy()
+	result.Parameters = ge.Parameters[:len(ge.Parameters):len(ge.Parameters)]
+	result.Notes = ge.Notes[:len(ge.Notes):len(ge.Notes)]
 	for _, value := range params {
-		ser, err := json.Marshal(value)
-		if err != nil {
-			panic(err)
+		ser, note := marshalParameter(value)
+		if note != "" {
+			result.Notes = append(result.Notes, fmt.Sprintf("parameter P%d %s", len(result.Parameters), note))
+		}
+		result.Parameters = append(result.Parameters, string(ser))
+	}
+	return result
+}
+
+// WithField returns a copy of the error that tracks a named parameter in the operation error. A field with the same
+// name is replaced. Values that cannot be marshalled or exceed ParameterSize are stored with a note describing the
+// problem.
+func (ge *GenericError) WithField(name string, value interface{}) *GenericError {
+	return ge.WithFields(map[string]interface{}{name: value})
+}
+
+// WithFields returns a copy of the error that tracks a set of named parameters in the operation error.
+func (ge *GenericError) WithFields(fields map[string]interface{}) *GenericError {
+	result := ge.copy()
+	result.Fields = make(map[string]json.RawMessage, len(ge.Fields)+len(fields))
+	for name, value := range ge.Fields {
+		result.Fields[name] = value
+	}
+	result.Notes = ge.Notes[:len(ge.Notes):len(ge.Notes)]
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ser, note := marshalParameter(fields[name])
+		if note != "" {
+			result.Notes = append(result.Notes, fmt.Sprintf("field %s %s", name, note))
 		}
-		ge.Parameters = append(ge.Parameters, string(ser))
+		result.Fields[name] = ser
 	}
-	return ge
+	return result
 }
 
-// CausedBy permits to link the error with a parent error. In this way, we can express the fact that a component
-// fails cause another component fails.
+// Field returns the JSON value of a named parameter, and whether it exists.
+func (ge *GenericError) Field(name string) (json.RawMessage, bool) {
+	value, exists := ge.Fields[name]
+	return value, exists
+}
+
+// FieldValue unmarshals the JSON value of a named parameter into the target. It returns false if the field does not
+// exist or cannot be unmarshalled into the target.
+func (ge *GenericError) FieldValue(name string, target interface{}) bool {
+	value, exists := ge.Fields[name]
+	if !exists {
+		return false
+	}
+	return json.Unmarshal(value, target) == nil
+}
+
+// WithGoroutineDump returns a copy of the error with a dump of all the goroutines of the process using the limits of
+// the current DumpOptions.
+func (ge *GenericError) WithGoroutineDump() *GenericError {
+	result := ge.copy()
+	result.Goroutines = CaptureGoroutineDump(CurrentDumpOptions())
+	return result
+}
+
+// CausedBy returns a copy of the error linked with a parent error. In this way, we can express the fact that a
+// component fails cause another component fails.
 func (ge *GenericError) CausedBy(parent Error) *GenericError {
-	ge.Parent = parent
-	return ge
+	result := ge.copy()
+	result.Parent = parent
+	if isNilError(parent) {
+		result.Parent = nil
+	}
+	return result
+}
+
+// copy returns a shallow copy of the error. The copy shares the unchanged data and the stack trace of the original
+// error.
+func (ge *GenericError) copy() *GenericError {
+	result := *ge
+	return &result
 }
 
 // StackTraceAsString returns the stack trace elements as a string array.
 func (ge *GenericError) StackTraceAsString() []string {
 	result := make([]string, 0)
-	for _, entry := range ge.Stack {
+	for _, entry := range ge.StackTrace() {
 		result = append(result, entry.String())
 	}
 	return result
@@ -92,26 +181,254 @@ func (ge *GenericError) StackTraceAsString() []string {
 
 // StackToString generates a string with a stack entry per line.
 func (ge *GenericError) StackToString() string {
+	return ge.stackToString(0)
+}
+
+// stackToString generates a string with a stack entry per line eliding a number of frames from the bottom of
+// the stack that are shared with the parent error.
+func (ge *GenericError) stackToString(common int) string {
 	var buffer bytes.Buffer
 	buffer.WriteString("StackTrace:\n")
-	for i, v := range ge.Stack {
+	stackTrace := ge.StackTrace()
+	snippets := CurrentSnippetOptions()
+	if ge.callers == nil {
+		// Only the sources of the frames captured by this process are read, never paths received from other ones.
+		snippets = &SnippetOptions{}
+	}
+	for i, v := range stackTrace[:len(stackTrace)-common] {
 		sep := fmt.Sprintf("ST%d: ", i)
 		buffer.WriteString(sep + v.String() + "\n")
+		if i < snippets.Frames {
+			buffer.WriteString(v.Snippet(snippets.ContextLines))
+		}
+	}
+	if common > 0 {
+		buffer.WriteString(fmt.Sprintf("... %d more frames in common with parent\n", common))
+	}
+	if len(stackTrace) == 0 && ge.RawStack != nil {
+		buffer.WriteString(ge.RawStack.String() + "\n")
+	}
+	if ge.Goroutine != nil {
+		buffer.WriteString("Goroutine: " + ge.Goroutine.String() + "\n")
 	}
 	return buffer.String()
 }
 
-// ParentError returns the parent error of the current Error or a standard golang error if the parent cannot be unmarshalled.
+// runtimePackages contains the packages whose frames are found at the bottom of the stack of any goroutine.
+var runtimePackages = []string{"runtime"}
+
+// commonFramesWithParent returns the number of frames at the bottom of the stack that are shared with the parent
+// error. Frames are only compared when both errors were captured in this process on the same goroutine, as far as
+// it is known, and at least one of the shared frames is not a runtime frame. Truncated stacks are not compared as
+// their bottom frames are unknown. Errors decoded together with their parent use the number of shared frames
+// computed by the process that created them.
+func (ge *GenericError) commonFramesWithParent() int {
+	parent, ok := ge.Parent.(*GenericError)
+	if !ok || parent == nil {
+		return 0
+	}
+	if ge.callers == nil || parent.callers == nil {
+		return ge.decodedCommonFrames(parent)
+	}
+	if ge.Goroutine != nil && parent.Goroutine != nil && ge.Goroutine.ID != parent.Goroutine.ID {
+		return 0
+	}
+	stackTrace := ge.StackTrace()
+	parentStackTrace := parent.StackTrace()
+	if isTruncated(stackTrace) || isTruncated(parentStackTrace) {
+		return 0
+	}
+	common := 0
+	shared := false
+	for common < len(stackTrace) && common < len(parentStackTrace) &&
+		stackTrace[len(stackTrace)-1-common] == parentStackTrace[len(parentStackTrace)-1-common] {
+		shared = shared || !matchesPackage(packageName(stackTrace[len(stackTrace)-1-common].FunctionName), runtimePackages)
+		common++
+	}
+	if !shared {
+		return 0
+	}
+	// Keep at least one frame to identify where the error was created.
+	if common == len(stackTrace) {
+		common--
+	}
+	return common
+}
+
+// decodedCommonFrames returns the number of frames shared with the parent recovered from the JSON representation,
+// if the parent is the one decoded together with the error.
+func (ge *GenericError) decodedCommonFrames(parent *GenericError) int {
+	if ge.decodedFrames == nil || ge.decodedFrames.parent != parent {
+		return 0
+	}
+	common := ge.decodedFrames.count
+	if length := len(ge.StackTrace()); common >= length {
+		common = length - 1
+	}
+	if common < 0 {
+		return 0
+	}
+	return common
+}
+
+// indent adds a tab to all the lines of a multiline text except the first one.
+func indent(text string) string {
+	return strings.Replace(strings.TrimRight(text, "\n"), "\n", "\n\t", -1)
+}
+
+// ErrorMessage returns the message of the error without the type.
+func (ge *GenericError) ErrorMessage() string {
+	return ge.Message
+}
+
+// ErrorParameters returns a copy of the JSON representation of the positional parameters of the error.
+func (ge *GenericError) ErrorParameters() []string {
+	return append(make([]string, 0, len(ge.Parameters)), ge.Parameters...)
+}
+
+// ErrorFields returns a copy of the JSON representation of the named parameters of the error.
+func (ge *GenericError) ErrorFields() map[string]json.RawMessage {
+	result := make(map[string]json.RawMessage, len(ge.Fields))
+	for name, value := range ge.Fields {
+		result[name] = value
+	}
+	return result
+}
+
+// ErrorCauses returns the original errors that caused the error. Causes recovered from a serialized error are
+// returned as their equivalent errors.
+func (ge *GenericError) ErrorCauses() []error {
+	result := make([]error, 0, len(ge.Causes))
+	for i := range ge.Causes {
+		if err := ge.Causes[i].Err(); err != nil {
+			result = append(result, err)
+		}
+	}
+	return result
+}
+
+// DecorateParams returns a copy of the error with extra positional parameters. It is equivalent to WithParams.
+func (ge *GenericError) DecorateParams(params ...interface{}) ExtendedError {
+	return ge.WithParams(params...)
+}
+
+// DecorateField returns a copy of the error with a named parameter. It is equivalent to WithField.
+func (ge *GenericError) DecorateField(name string, value interface{}) ExtendedError {
+	return ge.WithField(name, value)
+}
+
+// DecorateFields returns a copy of the error with a set of named parameters. It is equivalent to WithFields.
+func (ge *GenericError) DecorateFields(fields map[string]interface{}) ExtendedError {
+	return ge.WithFields(fields)
+}
+
+// DecorateParent returns a copy of the error linked with a parent error. It is equivalent to CausedBy.
+func (ge *GenericError) DecorateParent(parent Error) ExtendedError {
+	return ge.CausedBy(parent)
+}
+
+// ParentError returns the parent error of the current Error. The error is kept for compatibility as the parent
+// is already available once the error has been unmarshalled.
 func (ge *GenericError) ParentError() (Error, error) {
-	ser, err := json.Marshal(ge.Parent)
-	if err != nil {
-		return nil, err
+	return ge.Parent, nil
+}
+
+// MarshalJSON marshals a GenericError. Parents that are not a GenericError are transformed into an equivalent
+// GenericError so they can be unmarshalled. The stack trace is serialized following the current StackEncoding.
+func (ge *GenericError) MarshalJSON() ([]byte, error) {
+	// Use an alias type to avoid calling MarshalJSON recursively.
+	type plainGenericError GenericError
+	stackTrace, rawStack := ge.StackTrace(), ge.RawStack
+	if ge.callers != nil && CurrentStackEncoding() == ProgramCounterStack {
+		stackTrace, rawStack = make([]StackEntry, 0), ge.callers.RawStack()
+	}
+	return json.Marshal(struct {
+		*plainGenericError
+		Parent       *GenericError `json:"parent"`
+		Stack        []StackEntry  `json:"stackTrace"`
+		RawStack     *RawStack     `json:"rawStack,omitempty"`
+		CommonFrames int           `json:"commonFrames,omitempty"`
+		Instance     string        `json:"instance,omitempty"`
+	}{(*plainGenericError)(ge), ToGenericError(ge.Parent), stackTrace, rawStack, ge.commonFramesWithParent(),
+		ge.InstanceID()})
+}
+
+// UnmarshalJSON unmarshals a GenericError. The parent is recovered as a GenericError. Parents that are not
+// serialized as an object are recovered as a Generic error with the given message.
+func (ge *GenericError) UnmarshalJSON(data []byte) error {
+	// Use an alias type to avoid calling UnmarshalJSON recursively.
+	type plainGenericError GenericError
+	aux := struct {
+		*plainGenericError
+		Parent       json.RawMessage `json:"parent"`
+		CommonFrames int             `json:"commonFrames"`
+	}{plainGenericError: (*plainGenericError)(ge)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	ge.callers = nil
+	ge.instance = nil
+	ge.decodedFrames = nil
+	ge.Parent = nil
+	if len(aux.Parent) == 0 || string(aux.Parent) == "null" {
+		return nil
+	}
+	var message string
+	if err := json.Unmarshal(aux.Parent, &message); err == nil {
+		ge.Parent = &GenericError{
+			ErrorType:  Generic,
+			Message:    message,
+			Parameters: make([]string, 0),
+			Causes:     make([]Cause, 0),
+			Stack:      make([]StackEntry, 0),
+		}
+		return nil
 	}
-	return FromJSON(ser)
+	parent := &GenericError{}
+	if err := json.Unmarshal(aux.Parent, parent); err != nil {
+		return err
+	}
+	ge.Parent = parent
+	if aux.CommonFrames > 0 {
+		ge.decodedFrames = &sharedFrames{parent, aux.CommonFrames}
+	}
+	return nil
+}
+
+// ToGenericError transforms an Error into a GenericError so it can be serialized. A GenericError is returned as it
+// is. The message, parameters, fields, causes and parent of errors that implement Inspector are preserved, while
+// only the type, the string representation without the type prefix and the stack trace of other errors are kept.
+func ToGenericError(err Error) *GenericError {
+	if isNilError(err) {
+		return nil
+	}
+	if genericError, ok := err.(*GenericError); ok {
+		return genericError
+	}
+	result := &GenericError{
+		ErrorType:  err.Type(),
+		Message:    strings.TrimPrefix(err.Error(), "["+ErrorTypeAsString(err.Type())+"] "),
+		Parameters: make([]string, 0),
+		Causes:     make([]Cause, 0),
+		Stack:      err.StackTrace(),
+		instance:   &instanceID{},
+	}
+	if inspector, ok := err.(Inspector); ok {
+		result.Message = inspector.ErrorMessage()
+		result.Parameters = append(result.Parameters, inspector.ErrorParameters()...)
+		if fields := inspector.ErrorFields(); len(fields) > 0 {
+			result.Fields = fields
+		}
+		result.Causes = ErrorsToCauses(inspector.ErrorCauses())
+		if parent, _ := inspector.ParentError(); !isNilError(parent) {
+			result.Parent = parent
+		}
+	}
+	return result
 }
 
 func (ge *GenericError) paramsToString() string {
-	if len(ge.Parameters) == 0 {
+	if len(ge.Parameters) == 0 && len(ge.Fields) == 0 {
 		return ""
 	}
 	var buffer bytes.Buffer
@@ -120,9 +437,24 @@ func (ge *GenericError) paramsToString() string {
 		sep := fmt.Sprintf("P%d: ", i)
 		buffer.WriteString(sep + PrettyPrintStruct(v) + "\n")
 	}
+	names := make([]string, 0, len(ge.Fields))
+	for name := range ge.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buffer.WriteString(name + ": " + string(ge.Fields[name]) + "\n")
+	}
 	return buffer.String()
 }
 
+func (ge *GenericError) notesToString() string {
+	if len(ge.Notes) == 0 {
+		return ""
+	}
+	return "Notes:\n" + strings.Join(ge.Notes, "\n") + "\n"
+}
+
 func (ge *GenericError) causesToString() string {
 	if len(ge.Causes) == 0 {
 		return ""
@@ -131,24 +463,44 @@ func (ge *GenericError) causesToString() string {
 	buffer.WriteString("Caused by:\n")
 	for i, v := range ge.Causes {
 		sep := fmt.Sprintf("C%d: ", i)
-		buffer.WriteString(sep + PrettyPrintStruct(v) + "\n")
+		buffer.WriteString(sep + indent(v.String()) + "\n")
 	}
 	return buffer.String()
 }
 
 func (ge *GenericError) parentToString() string {
-	if ge.Parent == nil {
+	if isNilError(ge.Parent) {
 		return ""
 	}
 	var buffer bytes.Buffer
 	buffer.WriteString("Parent:\n")
-	parent, err := ge.ParentError()
+	buffer.WriteString(ge.Parent.DebugReport())
+	return buffer.String()
+}
+
+// Unwrap returns the errors wrapped by the current one, that is, the parent error linked with CausedBy and the
+// original causes used to create the error. This permits to use errors.Is and errors.As on a GenericError.
+func (ge *GenericError) Unwrap() []error {
+	result := make([]error, 0, len(ge.Causes)+1)
+	if !isNilError(ge.Parent) {
+		result = append(result, ge.Parent)
+	}
+	return append(result, ge.ErrorCauses()...)
+}
+
+// Is checks if the target error is a derrors Error with the same ErrorType as the current one.
+func (ge *GenericError) Is(target error) bool {
+	targetError, ok := target.(Error)
+	return ok && !isNilError(targetError) && targetError.Type() == ge.ErrorType
+}
+
+// isNilError checks if an Error is nil, including a nil pointer of a type implementing Error.
+func isNilError(err Error) bool {
 	if err == nil {
-		buffer.WriteString(parent.DebugReport())
-	} else {
-		buffer.WriteString("Cannot deserialize parent error:" + err.Error() + "\n")
+		return true
 	}
-	return buffer.String()
+	value := reflect.ValueOf(err)
+	return value.Kind() == reflect.Ptr && value.IsNil()
 }
 
 // Error returns the simplyfied golang error interface value.
@@ -161,14 +513,41 @@ func (ge *GenericError) Type() ErrorType {
 	return ge.ErrorType
 }
 
-// DebugReport returns a detailed error report including the stack information.
+// DebugReport returns a detailed error report including the stack information. The frames shared with the parent
+// error are elided from the stack of the error.
 func (ge *GenericError) DebugReport() string {
-	return fmt.Sprintf("%s\n%s\n%s\n%s\n%s",
-		ge.Error(), ge.paramsToString(), ge.causesToString(), ge.StackToString(), ge.parentToString())
+	params := ge.paramsToString() + ge.notesToString() + ge.metadataToString()
+	stack := ge.stackToString(ge.commonFramesWithParent()) + ge.goroutinesToString() + ge.resourcesToString()
+	return fmt.Sprintf("%s\n%s\n%s\n%s\n%s", ge.Error(), params, ge.causesToString(), stack, ge.parentToString())
+}
+
+// goroutinesToString returns the string representation of the goroutine dump, if any.
+func (ge *GenericError) goroutinesToString() string {
+	if ge.Goroutines == nil {
+		return ""
+	}
+	return ge.Goroutines.String()
 }
 
-// StackTrace returns an array with the calling stack that created the error.
+// resourcesToString returns the string representation of the resource snapshot, if any.
+func (ge *GenericError) resourcesToString() string {
+	if ge.Resources == nil {
+		return ""
+	}
+	return ge.Resources.String()
+}
+
+// StackTrace returns an array with the calling stack that created the error. The current StackPolicy is applied
+// to the result.
 func (ge *GenericError) StackTrace() []StackEntry {
+	return CurrentStackPolicy().Apply(ge.rawStackTrace())
+}
+
+// rawStackTrace returns the calling stack that created the error without applying the StackPolicy.
+func (ge *GenericError) rawStackTrace() []StackEntry {
+	if ge.Stack == nil && ge.callers != nil {
+		return ge.callers.StackTrace()
+	}
 	return ge.Stack
 }
 
@@ -189,21 +568,6 @@ func AsErrorWithParams(err error, msg string, params ...interface{}) Error {
 	return nil
 }
 
-// GetStackTrace retrieves the calling stack and transform that information into an array of StackEntry.
-func GetStackTrace() []StackEntry {
-	var programCounters [32]uintptr
-	// Skip the three first callers.
-	callersToSkip := 3
-	callerCount := runtime.Callers(callersToSkip, programCounters[:])
-	stackTrace := make([]StackEntry, callerCount)
-	for i := 0; i < callerCount; i++ {
-		function := runtime.FuncForPC(programCounters[i])
-		filePath, line := function.FileLine(programCounters[i])
-		stackTrace[i] = *NewStackEntry(function.Name(), filePath, line)
-	}
-	return stackTrace
-}
-
 // ErrorsToString transform a list of errors into a list of strings.
 func ErrorsToString(errors []error) []string {
 	result := make([]string, len(errors))
@@ -226,180 +590,126 @@ func PrettyPrintStruct(data interface{}) string {
 	return fmt.Sprintf("%#v", data)
 }
 
+// newError creates a new GenericError capturing the calling stack. The skip parameter is the number of callers to
+// skip, with 0 identifying the caller of newError.
+func newError(skip int, errorType ErrorType, msg string, causes []error) *GenericError {
+	return newErrorCtx(nil, skip+1, errorType, msg, causes)
+}
+
+// newErrorCtx creates a new GenericError capturing the calling stack and the metadata of the context, if any. The
+// skip parameter is the number of callers to skip, with 0 identifying the caller of newErrorCtx.
+func newErrorCtx(ctx context.Context, skip int, errorType ErrorType, msg string, causes []error) *GenericError {
+	result := &GenericError{
+		ErrorType:  errorType,
+		Message:    msg,
+		Parameters: make([]string, 0),
+		Causes:     ErrorsToCauses(causes),
+		callers:    captureCallers(skip + 1),
+		instance:   &instanceID{},
+	}
+	if CaptureGoroutineEnabled() {
+		result.Goroutine = CurrentGoroutine()
+	}
+	if options := CurrentDumpOptions(); options.dumpEnabled(errorType) {
+		result.Goroutines = CaptureGoroutineDump(options)
+	}
+	if errorType == ResourceExhausted && CaptureResourcesEnabled() {
+		result.Resources = CaptureResources()
+	}
+	if ctx != nil {
+		result.Metadata = ContextMetadata(ctx)
+	}
+	if TraceErrorsEnabled() {
+		traceError(ctx, result)
+	}
+	return result
+}
+
+// NewErrorWithCallerSkip creates a new GenericError with a given type skipping a number of callers from the top of
+// the stack trace. It is intended for helper functions that create errors, so they do not appear in the stack trace.
+// A skip of 0 is equivalent to NewError, a skip of 1 omits the function calling NewErrorWithCallerSkip.
+func NewErrorWithCallerSkip(skip int, errorType ErrorType, msg string, causes ...error) *GenericError {
+	return newError(skip+1, errorType, msg, causes)
+}
+
 // NewError creates a new GenericError with a given type.
 func NewError(errorType ErrorType, msg string, causes ...error) *GenericError {
-	return &GenericError{
-		errorType,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, errorType, msg, causes)
 }
 
 // NewGenericError returns a general purpose error.
 func NewGenericError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		Generic,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, Generic, msg, causes)
 }
 
 // NewCanceledError returns an error associated with an operation that has been canceled.
 func NewCanceledError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		Canceled,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, Canceled, msg, causes)
 }
 
 // NewInvalidArgumentError returns an error that indicates the use of an invalid argument.
 func NewInvalidArgumentError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		InvalidArgument,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, InvalidArgument, msg, causes)
 }
 
 // NewDeadlineExceededError returns an error that indicates the deadline for the completion of an operation expired.
 func NewDeadlineExceededError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		DeadlineExceeded,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, DeadlineExceeded, msg, causes)
 }
 
 // NewNotFoundError returns an error that indicates that the requested entity did not exists.
 func NewNotFoundError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		NotFound,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, NotFound, msg, causes)
 }
 
 // NewAlreadyExistsError returns an error that indicates that the target entity already exists.
 func NewAlreadyExistsError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		AlreadyExists,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, AlreadyExists, msg, causes)
 }
 
 // NewPermissionDeniedError returns an error that indicates that the client is not authorized.
 func NewPermissionDeniedError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		PermissionDenied,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, PermissionDenied, msg, causes)
 }
 
 // NewResourceExhaustedError returns an error that indicates that a given resource has been exhausted.
 func NewResourceExhaustedError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		ResourceExhausted,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, ResourceExhausted, msg, causes)
 }
 
 // NewFailedPreconditionError returns an error that indicates that a given precondition for an operation failed.
 func NewFailedPreconditionError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		FailedPrecondition,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, FailedPrecondition, msg, causes)
 }
 
 // NewAbortedError returns an error that indicates that a given operation was aborted due to an internal issue.
 func NewAbortedError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		Aborted,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, Aborted, msg, causes)
 }
 
 // NewOutOfRangeError returns an error that indicates that a requested resource is out of the available range.
 func NewOutOfRangeError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		OutOfRange,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, OutOfRange, msg, causes)
 }
 
 // NewUnimplementedError returns an error that indicates that a requested operation is not implemented yet.
 func NewUnimplementedError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		Unimplemented,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, Unimplemented, msg, causes)
 }
 
 // NewInternalError returns an error that indicates that an internal error occurred.
 func NewInternalError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		Internal,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, Internal, msg, causes)
 }
 
 // NewUnavailableError returns an error that indicates that a given service is not currently available.
 func NewUnavailableError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		Unavailable,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, Unavailable, msg, causes)
 }
 
 // NewUnauthenticatedError returns an error that indicates that a given request is not authenticated.
 func NewUnauthenticatedError(msg string, causes ...error) *GenericError {
-	return &GenericError{
-		Unauthenticated,
-		msg,
-		make([]string, 0),
-		ErrorsToString(causes),
-		nil,
-		GetStackTrace()}
+	return newError(1, Unauthenticated, msg, causes)
 }
 
 // FromJSON unmarshalls a byte array with the JSON representation into an Error of the correct type.
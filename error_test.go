@@ -24,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -305,3 +306,255 @@ func TestDP1283WithoutAnything(t *testing.T) {
 	}
 
 }
+
+type testCustomError struct {
+	code int
+}
+
+func (tce *testCustomError) Error() string {
+	return fmt.Sprintf("custom error %d", tce.code)
+}
+
+func TestUnwrapCauses(t *testing.T) {
+	sentinel := errors.New("no rows")
+	custom := &testCustomError{42}
+	err := NewNotFoundError("entity not found", sentinel, custom)
+	assertEquals(t, 2, len(err.Unwrap()), "expecting causes")
+	assertTrue(t, errors.Is(err, sentinel), "expecting sentinel in the chain")
+	var target *testCustomError
+	assertTrue(t, errors.As(err, &target), "expecting custom error in the chain")
+	assertEquals(t, 42, target.code, "expecting same custom error")
+}
+
+func TestUnwrapParent(t *testing.T) {
+	sentinel := errors.New("connection refused")
+	parent := NewUnavailableError("cannot connect", sentinel)
+	err := NewInternalError("operation failed").CausedBy(parent)
+	assertTrue(t, errors.Is(err, sentinel), "expecting parent cause in the chain")
+	var target *GenericError
+	assertTrue(t, errors.As(err, &target), "expecting generic error")
+	assertEquals(t, Internal, target.Type(), "expecting first error of the chain")
+}
+
+func TestUnwrapDeserializedParent(t *testing.T) {
+	err := NewInternalError("operation failed").CausedBy(NewUnavailableError("cannot connect"))
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertTrue(t, errors.Is(recovered, NewUnavailableError("")), "expecting parent in the chain")
+}
+
+func TestIs(t *testing.T) {
+	err := NewNotFoundError("entity not found")
+	assertTrue(t, errors.Is(err, NewNotFoundError("other entity")), "expecting same error type")
+	assertTrue(t, !errors.Is(err, NewInternalError("entity not found")), "expecting different error type")
+	assertTrue(t, !errors.Is(err, errors.New("entity not found")), "expecting no match with golang errors")
+}
+
+func TestStructuredCauses(t *testing.T) {
+	nested := NewNotFoundError("entity not found").WithParams("id1")
+	err := NewInternalError("operation failed", nested, errors.New("golang error"))
+	assertEquals(t, 2, len(err.Causes), "expecting causes")
+	assertEquals(t, nested, err.Causes[0].Error, "expecting nested error")
+	assertEquals(t, "*errors.errorString", err.Causes[1].Foreign.TypeName, "expecting foreign error type")
+	assertEquals(t, "golang error", err.Causes[1].Foreign.Message, "expecting foreign error message")
+
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	causes := recovered.(*GenericError).Causes
+	assertEquals(t, NotFound, causes[0].Error.Type(), "expecting nested error type")
+	assertEquals(t, nested.Parameters, causes[0].Error.Parameters, "expecting nested error parameters")
+	assertEquals(t, nested.StackTrace(), causes[0].Error.StackTrace(), "expecting nested error stack")
+	assertEquals(t, err.Causes[1].Foreign.String(), causes[1].Foreign.String(), "expecting foreign error")
+	assertEquals(t, err.DebugReport(), recovered.DebugReport(), "debug report must be equal")
+	assertTrue(t, strings.Contains(err.DebugReport(), indent(nested.StackToString())),
+		"expecting nested stack in the report")
+}
+
+func TestCausesFromPreviousVersion(t *testing.T) {
+	data := []byte(`{"errorType":1,"message":"msg","parameters":[],"causes":["golang error"],"parent":null,"stackTrace":[]}`)
+	recovered, err := FromJSON(data)
+	assertTrue(t, err == nil, "deserialization must work")
+	causes := recovered.(*GenericError).Causes
+	assertEquals(t, 1, len(causes), "expecting one cause")
+	assertEquals(t, "golang error", causes[0].Foreign.Message, "expecting cause message")
+}
+
+func TestParentRoundTrip(t *testing.T) {
+	grandParent := NewUnavailableError("cannot connect").WithParams("host1")
+	parent := NewInternalError("cannot store", NewNotFoundError("entity not found")).CausedBy(grandParent)
+	err := NewGenericError("operation failed").WithParams(NewMockStruct()).CausedBy(parent)
+
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertSameStructure(t, err, recovered)
+	assertEquals(t, err.DebugReport(), recovered.DebugReport(), "debug report must be equal")
+	_, isGenericError := recovered.(*GenericError).Parent.(*GenericError)
+	assertTrue(t, isGenericError, "expecting typed parent")
+}
+
+func TestParentFromPreviousVersion(t *testing.T) {
+	data := []byte(`{"errorType":1,"message":"msg","parameters":[],"causes":[],"parent":"parent error","stackTrace":[]}`)
+	recovered, err := FromJSON(data)
+	assertTrue(t, err == nil, "deserialization must work")
+	parent, err := recovered.(*GenericError).ParentError()
+	assertTrue(t, err == nil, "expecting parent")
+	assertEquals(t, "[Generic] parent error", parent.Error(), "expecting parent message")
+
+	data = []byte(`{"errorType":1,"message":"msg","parameters":[],"causes":[],"parent":null,"stackTrace":[]}`)
+	recovered, err = FromJSON(data)
+	assertTrue(t, err == nil, "deserialization must work")
+	assertTrue(t, recovered.(*GenericError).Parent == nil, "expecting no parent")
+}
+
+func TestNilParent(t *testing.T) {
+	err := NewInternalError("operation failed").CausedBy(func() *GenericError { return nil }())
+	assertTrue(t, err.Parent == nil, "expecting no parent")
+
+	direct := NewInternalError("operation failed")
+	direct.Parent = (*GenericError)(nil)
+	for _, current := range []*GenericError{err, direct} {
+		data, errSer := json.Marshal(current)
+		assertTrue(t, errSer == nil, "serialization must work")
+		recovered, errDes := FromJSON(data)
+		assertTrue(t, errDes == nil, "deserialization must work")
+		assertTrue(t, recovered.(*GenericError).Parent == nil, "expecting no recovered parent")
+		assertTrue(t, errors.Is(current, NewInternalError("")), "expecting same error type")
+		assertTrue(t, !errors.Is(current, (*GenericError)(nil)), "expecting no match with nil errors")
+		assertEquals(t, Fingerprint(err), Fingerprint(current), "expecting fingerprint")
+		assertTrue(t, !strings.Contains(current.DebugReport(), "Parent:"), "expecting no parent in the report")
+		assertTrue(t, current.Sanitize(false, false) != nil, "expecting sanitized error")
+	}
+}
+
+type testCustomDerror struct {
+	*GenericError
+}
+
+func (tcd *testCustomDerror) Error() string {
+	return "custom derror"
+}
+
+func TestNonGenericParent(t *testing.T) {
+	parent := &testCustomDerror{NewNotFoundError("entity not found")}
+	err := NewInternalError("operation failed").CausedBy(parent)
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	recoveredParent := recovered.(*GenericError).Parent
+	assertEquals(t, NotFound, recoveredParent.Type(), "expecting parent type")
+	assertEquals(t, "entity not found", recoveredParent.(*GenericError).Message, "expecting parent message")
+}
+
+func TestNonGenericCauses(t *testing.T) {
+	custom := &testCustomDerror{NewNotFoundError("entity not found").WithParams("id1").WithField("orgID", "org1")}
+	wrapped := fmt.Errorf("cannot read: %w", NewUnavailableError("cannot connect"))
+	err := NewInternalError("operation failed", custom, wrapped)
+
+	assertTrue(t, err.Causes[0].Error != nil, "expecting nested error")
+	assertEquals(t, NotFound, err.Causes[0].Error.Type(), "expecting cause type")
+	assertEquals(t, []string{`"id1"`}, err.Causes[0].Error.Parameters, "expecting cause parameters")
+	assertEquals(t, `"org1"`, string(err.Causes[0].Error.Fields["orgID"]), "expecting cause fields")
+	assertEquals(t, custom.StackTrace(), err.Causes[0].Error.StackTrace(), "expecting cause stack")
+	assertTrue(t, err.Causes[1].Error != nil, "expecting nested wrapped error")
+	assertEquals(t, Unavailable, err.Causes[1].Error.Type(), "expecting wrapped cause type")
+	assertEquals(t, wrapped.Error(), err.Causes[1].Foreign.Message, "expecting wrapping error message")
+
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	causes := recovered.(*GenericError).Causes
+	assertEquals(t, NotFound, causes[0].Error.Type(), "expecting recovered cause type")
+	assertEquals(t, wrapped.Error(), causes[1].Foreign.Message, "expecting recovered wrapping error message")
+	assertEquals(t, Unavailable, causes[1].Error.Type(), "expecting recovered wrapped cause type")
+	assertTrue(t, errors.Is(recovered, NewUnavailableError("")), "expecting recovered wrapped cause in the chain")
+	assertEquals(t, err.DebugReport(), recovered.DebugReport(), "debug report must be equal")
+}
+
+func TestUnwrapNonGenericCauses(t *testing.T) {
+	sentinel := errors.New("no rows")
+	custom := &testCustomDerror{NewNotFoundError("entity not found")}
+	wrapped := fmt.Errorf("cannot read %w: %w", sentinel, NewUnavailableError("cannot connect"))
+	err := NewInternalError("operation failed", custom, wrapped)
+
+	var target *testCustomDerror
+	assertTrue(t, errors.As(err, &target), "expecting custom error in the chain")
+	assertTrue(t, target == custom, "expecting same custom error")
+	assertTrue(t, errors.Is(err, sentinel), "expecting wrapped sentinel in the chain")
+	assertTrue(t, errors.Is(err, NewUnavailableError("")), "expecting wrapped error in the chain")
+	assertEquals(t, []error{custom, wrapped}, err.ErrorCauses(), "expecting original causes")
+	assertTrue(t, strings.Contains(err.DebugReport(), "cannot read no rows: [Unavailable] cannot connect"),
+		"expecting wrapping error in the report")
+}
+
+func TestWithFields(t *testing.T) {
+	err := NewNotFoundError("entity not found").WithParams("legacy").WithField("orgID", "org1").
+		WithFields(map[string]interface{}{"attempts": 3, "entity": NewMockStruct()})
+	value, exists := err.Field("orgID")
+	assertTrue(t, exists, "expecting field")
+	assertEquals(t, `"org1"`, string(value), "expecting JSON value")
+	_, exists = err.Field("missing")
+	assertTrue(t, !exists, "expecting missing field")
+
+	var attempts int
+	assertTrue(t, err.FieldValue("attempts", &attempts), "expecting field value")
+	assertEquals(t, 3, attempts, "expecting typed value")
+	var entity MockStruct
+	assertTrue(t, err.FieldValue("entity", &entity), "expecting field value")
+	assertEquals(t, *NewMockStruct(), entity, "expecting typed value")
+	assertTrue(t, !err.FieldValue("orgID", &attempts), "expecting mismatched type")
+
+	err = err.WithField("attempts", 4)
+	assertTrue(t, err.FieldValue("attempts", &attempts), "expecting field value")
+	assertEquals(t, 4, attempts, "expecting replaced value")
+	assertTrue(t, strings.Contains(err.DebugReport(),
+		"Parameters:\nP0: "+PrettyPrintStruct(`"legacy"`)+"\nattempts: 4\nentity: "+string(err.Fields["entity"])+"\norgID: \"org1\"\n"),
+		"expecting named fields in the report")
+}
+
+var errTestSentinel = NewNotFoundError("entity not found")
+
+func TestImmutableDecorators(t *testing.T) {
+	base := NewInternalError("operation failed").WithParams("p0").WithField("f0", 0)
+	first := base.WithParams("p1").WithField("f1", 1).CausedBy(errTestSentinel)
+	second := base.WithParams("p2").WithField("f1", 2)
+
+	assertEquals(t, []string{`"p0"`}, base.Parameters, "base parameters must not change")
+	assertEquals(t, 1, len(base.Fields), "base fields must not change")
+	assertTrue(t, base.Parent == nil, "base parent must not change")
+	assertEquals(t, []string{`"p0"`, `"p1"`}, first.Parameters, "expecting first parameters")
+	assertEquals(t, []string{`"p0"`, `"p2"`}, second.Parameters, "expecting second parameters")
+	assertEquals(t, "1", string(first.Fields["f1"]), "expecting first field")
+	assertEquals(t, "2", string(second.Fields["f1"]), "expecting second field")
+	assertTrue(t, second.Parent == nil, "parent must not leak between copies")
+	assertEquals(t, base.StackTrace(), first.StackTrace(), "copies share the stack trace")
+}
+
+func TestConcurrentDecorators(t *testing.T) {
+	var wg sync.WaitGroup
+	results := make([]*GenericError, 16)
+	for i := range results {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			results[index] = errTestSentinel.WithParams(index).WithField("request", index).
+				CausedBy(NewUnavailableError("cannot connect"))
+			_ = results[index].DebugReport()
+		}(i)
+	}
+	wg.Wait()
+	assertEquals(t, 0, len(errTestSentinel.Parameters), "sentinel parameters must not change")
+	assertTrue(t, errTestSentinel.Fields == nil && errTestSentinel.Parent == nil, "sentinel must not change")
+	for i, result := range results {
+		assertEquals(t, []string{fmt.Sprintf("%d", i)}, result.Parameters, "parameters must not leak")
+		var request int
+		assertTrue(t, result.FieldValue("request", &request) && request == i, "fields must not leak")
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Fingerprints to group and deduplicate errors.
+
+package derrors
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+)
+
+// FingerprintOptions structure that defines how the fingerprint of an error is computed.
+type FingerprintOptions struct {
+	// Frames is the number of stack frames of each error of the chain that are considered.
+	Frames int
+	// IgnoreLines excludes the line numbers of the frames, so the fingerprint does not change when unrelated code
+	// is added to the same file.
+	IgnoreLines bool
+	// LibraryPackages contains the packages whose frames are not considered. The frames of the derrors packages are
+	// never considered.
+	LibraryPackages []string
+}
+
+// DefaultFingerprintOptions contains the options used by Fingerprint.
+var DefaultFingerprintOptions = FingerprintOptions{
+	Frames:          5,
+	IgnoreLines:     true,
+	LibraryPackages: LibraryPackages,
+}
+
+// messageVariables contains the expressions that match the variable elements of a message and their replacement.
+var messageVariables = []struct {
+	expression  *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`"[^"]*"|'[^']*'`), "<str>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b|\b[0-9a-f]*[0-9][0-9a-f]*[a-f][0-9a-f]*\b`), "<hex>"},
+	{regexp.MustCompile(`\d+(\.\d+)?`), "<num>"},
+}
+
+// NormalizeMessage returns the template of a message replacing the variable elements such as quoted strings,
+// identifiers and numbers with placeholders.
+func NormalizeMessage(message string) string {
+	for _, variable := range messageVariables {
+		message = variable.expression.ReplaceAllString(message, variable.replacement)
+	}
+	return message
+}
+
+// Fingerprint returns a stable identifier of an error that can be used to group equivalent errors. It is computed
+// using the DefaultFingerprintOptions from the error type, the normalized message and the top frames of the stack
+// trace of each error in the parent chain. Parameters are not considered. The StackPolicy is not applied to the stack
+// traces, so only the LibraryPackages of the options filter the frames. The fingerprint is preserved when the error
+// is serialized, as long as the stack traces are symbolized and the StackPolicy of the process that serialized them
+// did not hide frames that are not filtered by the options.
+func Fingerprint(err Error) string {
+	return FingerprintWithOptions(err, DefaultFingerprintOptions)
+}
+
+// FingerprintWithOptions returns a stable identifier of an error computed with the given options.
+func FingerprintWithOptions(err Error, options FingerprintOptions) string {
+	hash := sha256.New()
+	for current := err; !isNilError(current); {
+		genericError := ToGenericError(current)
+		hash.Write([]byte(ErrorTypeAsString(genericError.ErrorType) + "\n"))
+		hash.Write([]byte(NormalizeMessage(genericError.Message) + "\n"))
+		frames := 0
+		for _, entry := range genericError.rawStackTrace() {
+			if frames >= options.Frames {
+				break
+			}
+			pkg := packageName(entry.FunctionName)
+			if entry.Omitted > 0 || isOwnFrame(pkg, entry.File) || matchesPackage(pkg, options.LibraryPackages) {
+				continue
+			}
+			frame := entry.FunctionName
+			if !options.IgnoreLines {
+				frame += ":" + strconv.Itoa(entry.Line)
+			}
+			hash.Write([]byte(frame + "\n"))
+			frames++
+		}
+		// Separate the elements of each error of the chain.
+		hash.Write([]byte("---\n"))
+		current = genericError.Parent
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
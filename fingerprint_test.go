@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Fingerprint tests
+
+package derrors
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNormalizeMessage(t *testing.T) {
+	assertEquals(t, "user <str> not found in organization <uuid>",
+		NormalizeMessage(`user "john" not found in organization 5b1c2b5e-8a3f-4c2e-9d1a-0f6e7d8c9b0a`),
+		"expecting strings and identifiers to be replaced")
+	assertEquals(t, "retry <num> of <num> after <num>s, object <hex> at <hex>",
+		NormalizeMessage("retry 2 of 5 after 1.5s, object 5f3a9c2e at 0xc000123abc"),
+		"expecting numbers and hexadecimal values to be replaced")
+	assertEquals(t, "cannot connect to database", NormalizeMessage("cannot connect to database"),
+		"expecting same message")
+}
+
+func lookupUser(id string) *GenericError {
+	return NewNotFoundError("user " + id + " not found").WithParams(id)
+}
+
+func TestFingerprint(t *testing.T) {
+	first := lookupUser("1234")
+	second := lookupUser("5678")
+	assertEquals(t, 32, len(Fingerprint(first)), "expecting fingerprint")
+	assertEquals(t, Fingerprint(first), Fingerprint(second), "expecting same fingerprint")
+
+	other := NewNotFoundError("user 1234 not found")
+	assertTrue(t, Fingerprint(first) != Fingerprint(other), "expecting different origin")
+	notFound, internal := NewNotFoundError("user 1234 not found"), NewInternalError("user 1234 not found")
+	assertTrue(t, Fingerprint(notFound) != Fingerprint(internal), "expecting different type")
+
+	parent := NewUnavailableError("cannot connect")
+	assertTrue(t, Fingerprint(lookupUser("1").CausedBy(parent)) != Fingerprint(lookupUser("1")),
+		"expecting parent to be considered")
+	assertEquals(t, Fingerprint(lookupUser("1").CausedBy(parent)), Fingerprint(lookupUser("2").CausedBy(parent)),
+		"expecting same fingerprint with same parent")
+}
+
+func TestFingerprintLines(t *testing.T) {
+	errors := make([]*GenericError, 0)
+	errors = append(errors, NewInternalError("operation failed"))
+	errors = append(errors, NewInternalError("operation failed"))
+	assertEquals(t, Fingerprint(errors[0]), Fingerprint(errors[1]), "expecting lines to be ignored")
+	options := DefaultFingerprintOptions
+	options.IgnoreLines = false
+	assertTrue(t, FingerprintWithOptions(errors[0], options) != FingerprintWithOptions(errors[1], options),
+		"expecting lines to be considered")
+}
+
+func TestFingerprintRoundTrip(t *testing.T) {
+	err := lookupUser("1234").CausedBy(NewUnavailableError("cannot connect"))
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertEquals(t, Fingerprint(err), Fingerprint(recovered), "expecting same fingerprint")
+}
+
+func TestFingerprintStackPolicy(t *testing.T) {
+	defer SetStackPolicy(nil)
+	err := lookupUser("1234").CausedBy(NewUnavailableError("cannot connect"))
+	fingerprint := Fingerprint(err)
+	SetStackPolicy(&StackPolicy{HideOwnFrames: true, HiddenPackages: []string{"github.com/nalej/derrors"},
+		CollapsedPackages: []string{"testing"}})
+	assertEquals(t, fingerprint, Fingerprint(err), "expecting fingerprint not to depend on the policy")
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Identification of the goroutine that creates an error.
+
+package derrors
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// maxGoroutineStackSize is the maximum size of the stack read to identify the current goroutine.
+const maxGoroutineStackSize = 1 << 20
+
+// captureGoroutine indicates if the goroutine information is captured when an error is created.
+var captureGoroutine int32
+
+// SetCaptureGoroutine enables or disables capturing the goroutine information when an error is created. Notice
+// that reading the information of the goroutine is expensive as it requires formatting its full stack.
+func SetCaptureGoroutine(enabled bool) {
+	value := int32(0)
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&captureGoroutine, value)
+}
+
+// CaptureGoroutineEnabled checks if the goroutine information is captured when an error is created.
+func CaptureGoroutineEnabled() bool {
+	return atomic.LoadInt32(&captureGoroutine) == 1
+}
+
+// GoroutineInfo structure that identifies the goroutine that created an error.
+type GoroutineInfo struct {
+	// ID of the goroutine.
+	ID uint64 `json:"id"`
+	// CreatedBy contains the go statement that started the goroutine. It is not set for the main goroutine.
+	CreatedBy *StackEntry `json:"createdBy,omitempty"`
+	// CreatorID contains the ID of the goroutine that started the goroutine, if known.
+	CreatorID uint64 `json:"creatorId,omitempty"`
+}
+
+// CurrentGoroutine returns the information of the current goroutine parsed from its stack.
+func CurrentGoroutine() *GoroutineInfo {
+	buffer := make([]byte, 4096)
+	for {
+		count := runtime.Stack(buffer, false)
+		if count < len(buffer) || len(buffer) >= maxGoroutineStackSize {
+			return ParseGoroutine(buffer[:count])
+		}
+		buffer = make([]byte, 2*len(buffer))
+	}
+}
+
+// ParseGoroutine parses the information of a goroutine from its stack as formatted by runtime.Stack.
+func ParseGoroutine(stack []byte) *GoroutineInfo {
+	info, _, _ := parseGoroutine(strings.Split(string(bytes.TrimSpace(stack)), "\n"))
+	return info
+}
+
+// parseGoroutine parses the lines of the stack of a goroutine as formatted by runtime.Stack, returning the
+// information of the goroutine, its state and its frames.
+func parseGoroutine(lines []string) (*GoroutineInfo, string, []StackEntry) {
+	result := &GoroutineInfo{}
+	state := ""
+	frames := make([]StackEntry, 0)
+	if len(lines) == 0 {
+		return result, state, frames
+	}
+	// goroutine 18 [running]:
+	header := strings.Fields(lines[0])
+	if len(header) >= 2 && header[0] == "goroutine" {
+		result.ID, _ = strconv.ParseUint(header[1], 10, 64)
+	}
+	if start := strings.Index(lines[0], "["); start >= 0 {
+		if end := strings.Index(lines[0][start:], "]"); end >= 0 {
+			state = lines[0][start+1 : start+end]
+		}
+	}
+	for i := 1; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "\t") || strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		file, line := "", 0
+		if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\t") {
+			file, line = parseFileLine(lines[i+1])
+		}
+		if !strings.HasPrefix(lines[i], "created by ") {
+			// main.worker(0x1)
+			function := lines[i]
+			if index := strings.LastIndex(function, "("); index > 0 {
+				function = function[:index]
+			}
+			frames = append(frames, *NewStackEntry(function, file, line))
+			continue
+		}
+		// created by main.main in goroutine 1
+		function := strings.TrimPrefix(lines[i], "created by ")
+		if index := strings.LastIndex(function, " in goroutine "); index >= 0 {
+			result.CreatorID, _ = strconv.ParseUint(function[index+len(" in goroutine "):], 10, 64)
+			function = function[:index]
+		}
+		result.CreatedBy = NewStackEntry(function, file, line)
+		break
+	}
+	return result, state, frames
+}
+
+// parseFileLine parses the location of a frame as formatted by runtime.Stack.
+func parseFileLine(location string) (string, int) {
+	// \t/path/main.go:20 +0x45
+	location = strings.TrimSpace(location)
+	if index := strings.LastIndex(location, " +0x"); index >= 0 {
+		location = location[:index]
+	}
+	index := strings.LastIndex(location, ":")
+	if index < 0 {
+		return location, 0
+	}
+	line, err := strconv.Atoi(location[index+1:])
+	if err != nil {
+		return location, 0
+	}
+	return location[:index], line
+}
+
+// String returns the string representation of a GoroutineInfo.
+func (gi *GoroutineInfo) String() string {
+	if gi.CreatedBy == nil {
+		return fmt.Sprintf("goroutine %d", gi.ID)
+	}
+	if gi.CreatorID != 0 {
+		return fmt.Sprintf("goroutine %d created by %s in goroutine %d", gi.ID, gi.CreatedBy.String(), gi.CreatorID)
+	}
+	return fmt.Sprintf("goroutine %d created by %s", gi.ID, gi.CreatedBy.String())
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Goroutine identification tests
+
+package derrors
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseGoroutine(t *testing.T) {
+	stack := []byte(`goroutine 18 [running]:
+main.worker(0x1)
+	/src/app/main.go:12 +0x25
+created by main.startPool in goroutine 1
+	/src/app/pool.go:20 +0x45
+`)
+	info := ParseGoroutine(stack)
+	assertEquals(t, uint64(18), info.ID, "expecting goroutine ID")
+	assertEquals(t, NewStackEntry("main.startPool", "/src/app/pool.go", 20), info.CreatedBy, "expecting creator")
+	assertEquals(t, uint64(1), info.CreatorID, "expecting creator goroutine")
+	assertEquals(t, "goroutine 18 created by main.startPool - /src/app/pool.go:20 in goroutine 1", info.String(),
+		"expecting string representation")
+
+	main := ParseGoroutine([]byte("goroutine 1 [running]:\nmain.main()\n\t/src/app/main.go:5 +0x1d\n"))
+	assertEquals(t, uint64(1), main.ID, "expecting main goroutine")
+	assertTrue(t, main.CreatedBy == nil, "main goroutine has no creator")
+}
+
+func TestCaptureGoroutine(t *testing.T) {
+	assertTrue(t, NewInternalError("operation failed").Goroutine == nil, "capture must be disabled by default")
+	defer SetCaptureGoroutine(false)
+	SetCaptureGoroutine(true)
+	result := make(chan *GenericError)
+	go func() {
+		result <- NewInternalError("worker failed")
+	}()
+	err := <-result
+	assertTrue(t, err.Goroutine != nil && err.Goroutine.ID != 0, "expecting goroutine")
+	assertTrue(t, err.Goroutine.CreatedBy != nil, "expecting creator")
+	assertTrue(t, strings.HasSuffix(err.Goroutine.CreatedBy.FunctionName, ".TestCaptureGoroutine"),
+		"expecting test as creator")
+	assertTrue(t, strings.HasSuffix(err.Goroutine.CreatedBy.File, "goroutine_test.go"), "expecting creator file")
+	assertTrue(t, strings.Contains(err.DebugReport(), "Goroutine: "+err.Goroutine.String()),
+		"expecting goroutine in the report")
+
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertEquals(t, err.Goroutine, recovered.(*GenericError).Goroutine, "expecting serialized goroutine")
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Definition of the gRPC interceptors that translate derrors errors.
+
+package grpcx
+
+import (
+	"context"
+	"io"
+
+	"github.com/nalej/derrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns a server interceptor that transforms the errors returned by the handlers into
+// gRPC status.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, toRPCError(err, opts...)
+		}
+		return resp, nil
+	}
+}
+
+// StreamServerInterceptor returns a server interceptor that transforms the errors returned by the stream handlers
+// into gRPC status.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		if err != nil {
+			return toRPCError(err, opts...)
+		}
+		return nil
+	}
+}
+
+// UnaryClientInterceptor returns a client interceptor that transforms the received status into derrors errors.
+// The remote error is linked as the parent of the returned error.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err != nil {
+			return fromRPCError(method, err)
+		}
+		return nil
+	}
+}
+
+// StreamClientInterceptor returns a client interceptor that transforms the status received when opening a stream,
+// sending or receiving messages into derrors errors. The remote error is linked as the parent of the returned error.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, fromRPCError(method, err)
+		}
+		return &clientStream{stream, method}, nil
+	}
+}
+
+// clientStream wraps a client stream to transform the errors received on the stream.
+type clientStream struct {
+	grpc.ClientStream
+	method string
+}
+
+// SendMsg sends a message transforming the resulting error.
+func (cs *clientStream) SendMsg(m interface{}) error {
+	err := cs.ClientStream.SendMsg(m)
+	if err != nil && err != io.EOF {
+		return fromRPCError(cs.method, err)
+	}
+	return err
+}
+
+// RecvMsg receives a message transforming the resulting error.
+func (cs *clientStream) RecvMsg(m interface{}) error {
+	err := cs.ClientStream.RecvMsg(m)
+	if err != nil && err != io.EOF {
+		return fromRPCError(cs.method, err)
+	}
+	return err
+}
+
+// toRPCError transforms an error returned by a handler into a status error. Errors that already contain a status
+// are returned as they are, and plain golang errors are transformed into derrors errors.
+func toRPCError(err error, opts ...Option) error {
+	if derror, ok := err.(derrors.Error); ok {
+		return ToStatus(derror, opts...).Err()
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return ToStatus(derrors.AsError(err, err.Error()), opts...).Err()
+}
+
+// fromRPCError transforms an error received on a call into a derrors error whose parent is the remote error. The
+// received error is kept as a cause, so status.FromError and status.Code still work on the result. Errors that do
+// not contain a status are returned as they are.
+func fromRPCError(method string, err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	remote := FromStatus(st)
+	if remote == nil {
+		return err
+	}
+	message := st.Message()
+	if genericError, ok := remote.(*derrors.GenericError); ok {
+		message = genericError.Message
+	}
+	// Skip fromRPCError and the interceptor or stream method calling it.
+	return derrors.NewErrorWithCallerSkip(2, remote.Type(), message, err).WithParams(method).CausedBy(remote)
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nalej/derrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testMethod = "/test.Service/Method"
+
+func serverCall(handlerErr error) error {
+	interceptor := UnaryServerInterceptor()
+	_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: testMethod},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, handlerErr
+		})
+	return err
+}
+
+func clientCall(remoteErr error) error {
+	interceptor := UnaryClientInterceptor()
+	return interceptor(context.Background(), testMethod, nil, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return remoteErr
+		})
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	st, _ := status.FromError(serverCall(derrors.NewNotFoundError("entity not found")))
+	if st.Code() != codes.NotFound || st.Message() != "entity not found" {
+		t.Errorf("expecting not found status, got %s", st)
+	}
+	st, _ = status.FromError(serverCall(errors.New("golang error")))
+	if st.Code() != codes.Unknown {
+		t.Errorf("expecting unknown status, got %s", st)
+	}
+	original := status.Error(codes.Aborted, "aborted")
+	if serverCall(original) != original {
+		t.Error("expecting status error to be returned")
+	}
+	if serverCall(nil) != nil {
+		t.Error("expecting no error")
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor()
+	err := interceptor(nil, nil, &grpc.StreamServerInfo{FullMethod: testMethod},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			return derrors.NewUnavailableError("cannot connect")
+		})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("expecting unavailable status, got %s", err)
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	remote := derrors.NewNotFoundError("entity not found").WithParams("id1")
+	err := clientCall(serverCall(remote))
+	derror, ok := err.(*derrors.GenericError)
+	if !ok {
+		t.Fatalf("expecting derrors error, got %s", err)
+	}
+	if derror.Type() != derrors.NotFound || derror.Message != "entity not found" {
+		t.Errorf("expecting not found error, got %s", derror)
+	}
+	if derror.Parent == nil || derror.Parent.(*derrors.GenericError).Parameters[0] != remote.Parameters[0] {
+		t.Error("expecting remote error as parent")
+	}
+	if !strings.Contains(derror.DebugReport(), "Parent:\n[NotFound] entity not found") {
+		t.Errorf("expecting parent in the debug report, got %s", derror.DebugReport())
+	}
+	if !errors.Is(err, derrors.NewNotFoundError("")) {
+		t.Error("expecting error type to be matched")
+	}
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expecting not found code, got %s", status.Code(err))
+	}
+	if top := derror.StackTrace()[0].FunctionName; !strings.HasSuffix(top, ".clientCall") {
+		t.Errorf("expecting caller of the interceptor on top of the stack, got %s", top)
+	}
+	if clientCall(nil) != nil {
+		t.Error("expecting no error")
+	}
+	plain := errors.New("golang error")
+	if clientCall(plain) != plain {
+		t.Error("expecting non status error to be returned")
+	}
+}
+
+type testClientStream struct {
+	grpc.ClientStream
+	err error
+}
+
+func (tcs *testClientStream) RecvMsg(m interface{}) error {
+	return tcs.err
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	interceptor := StreamClientInterceptor()
+	remoteErr := serverCall(derrors.NewAbortedError("transaction aborted"))
+	stream, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, testMethod,
+		func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &testClientStream{err: remoteErr}, nil
+		})
+	if err != nil {
+		t.Fatalf("expecting stream, got %s", err)
+	}
+	recvErr := stream.RecvMsg(nil)
+	if derror, ok := recvErr.(derrors.Error); !ok || derror.Type() != derrors.Aborted {
+		t.Fatalf("expecting aborted error, got %s", recvErr)
+	}
+	if status.Code(recvErr) != codes.Aborted {
+		t.Errorf("expecting aborted code, got %s", status.Code(recvErr))
+	}
+	if top := recvErr.(derrors.Error).StackTrace()[0].FunctionName; !strings.HasSuffix(top, ".TestStreamClientInterceptor") {
+		t.Errorf("expecting caller of the stream on top of the stack, got %s", top)
+	}
+	stream.(*clientStream).ClientStream = &testClientStream{err: io.EOF}
+	if stream.RecvMsg(nil) != io.EOF {
+		t.Error("expecting EOF")
+	}
+}
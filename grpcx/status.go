@@ -0,0 +1,238 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package grpcx provides the conversion between derrors errors and gRPC status.
+package grpcx
+
+import (
+	"encoding/json"
+
+	"github.com/nalej/derrors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain used in the ErrorInfo details that contain a derrors error.
+const Domain = "derrors"
+
+// Keys of the ErrorInfo metadata used to transport the error elements.
+const (
+	MessageKey    = "message"
+	InstanceKey   = "instance"
+	ParametersKey = "parameters"
+	FieldsKey     = "fields"
+	NotesKey      = "notes"
+	MetadataKey   = "metadata"
+	CausesKey     = "causes"
+	ParentKey     = "parent"
+	StackTraceKey = "stackTrace"
+	GoroutineKey  = "goroutine"
+	GoroutinesKey = "goroutines"
+	ResourcesKey  = "resources"
+)
+
+// ErrorTypeCodes map associating error types with gRPC codes.
+var ErrorTypeCodes = map[derrors.ErrorType]codes.Code{
+	derrors.Generic:            codes.Unknown,
+	derrors.Canceled:           codes.Canceled,
+	derrors.InvalidArgument:    codes.InvalidArgument,
+	derrors.DeadlineExceeded:   codes.DeadlineExceeded,
+	derrors.NotFound:           codes.NotFound,
+	derrors.AlreadyExists:      codes.AlreadyExists,
+	derrors.PermissionDenied:   codes.PermissionDenied,
+	derrors.ResourceExhausted:  codes.ResourceExhausted,
+	derrors.FailedPrecondition: codes.FailedPrecondition,
+	derrors.Aborted:            codes.Aborted,
+	derrors.OutOfRange:         codes.OutOfRange,
+	derrors.Unimplemented:      codes.Unimplemented,
+	derrors.Internal:           codes.Internal,
+	derrors.Unavailable:        codes.Unavailable,
+	derrors.Unauthenticated:    codes.Unauthenticated,
+}
+
+// CodeErrorTypes map associating gRPC codes with error types.
+var CodeErrorTypes = map[codes.Code]derrors.ErrorType{
+	codes.Canceled:           derrors.Canceled,
+	codes.Unknown:            derrors.Generic,
+	codes.InvalidArgument:    derrors.InvalidArgument,
+	codes.DeadlineExceeded:   derrors.DeadlineExceeded,
+	codes.NotFound:           derrors.NotFound,
+	codes.AlreadyExists:      derrors.AlreadyExists,
+	codes.PermissionDenied:   derrors.PermissionDenied,
+	codes.ResourceExhausted:  derrors.ResourceExhausted,
+	codes.FailedPrecondition: derrors.FailedPrecondition,
+	codes.Aborted:            derrors.Aborted,
+	codes.OutOfRange:         derrors.OutOfRange,
+	codes.Unimplemented:      derrors.Unimplemented,
+	codes.Internal:           derrors.Internal,
+	codes.Unavailable:        derrors.Unavailable,
+	codes.DataLoss:           derrors.Internal,
+	codes.Unauthenticated:    derrors.Unauthenticated,
+}
+
+// ToCode returns the gRPC code associated with an error type.
+func ToCode(errorType derrors.ErrorType) codes.Code {
+	code, exists := ErrorTypeCodes[errorType]
+	if !exists {
+		return codes.Unknown
+	}
+	return code
+}
+
+// FromCode returns the error type associated with a gRPC code.
+func FromCode(code codes.Code) derrors.ErrorType {
+	errorType, exists := CodeErrorTypes[code]
+	if !exists {
+		return derrors.Generic
+	}
+	return errorType
+}
+
+// Option permits to modify the conversion of an error into a status.
+type Option func(*options)
+
+type options struct {
+	withStack bool
+}
+
+// WithStack includes the stack traces of the error in the status details.
+func WithStack() Option {
+	return func(o *options) {
+		o.withStack = true
+	}
+}
+
+// ToStatus transforms an Error into a gRPC status. The status code is obtained from the error type, and the
+// message, instance, parameters, fields, notes, metadata, causes and parent are included as an ErrorInfo detail. The
+// stack traces, goroutines and resources are only included with the WithStack option.
+func ToStatus(err derrors.Error, opts ...Option) *status.Status {
+	if err == nil {
+		return nil
+	}
+	config := &options{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	genericError := derrors.ToGenericError(err)
+	if !config.withStack {
+		genericError = genericError.Sanitize(false, true)
+	}
+	metadata := map[string]string{MessageKey: genericError.Message}
+	if instance := genericError.InstanceID(); instance != "" {
+		metadata[InstanceKey] = instance
+	}
+	addMetadata(metadata, ParametersKey, genericError.Parameters)
+	if len(genericError.Fields) > 0 {
+		addMetadata(metadata, FieldsKey, genericError.Fields)
+	}
+	if len(genericError.Notes) > 0 {
+		addMetadata(metadata, NotesKey, genericError.Notes)
+	}
+	if len(genericError.Metadata) > 0 {
+		addMetadata(metadata, MetadataKey, genericError.Metadata)
+	}
+	addMetadata(metadata, CausesKey, genericError.Causes)
+	if genericError.Parent != nil {
+		addMetadata(metadata, ParentKey, genericError.Parent)
+	}
+	if config.withStack {
+		addMetadata(metadata, StackTraceKey, genericError.StackTrace())
+		if genericError.Goroutine != nil {
+			addMetadata(metadata, GoroutineKey, genericError.Goroutine)
+		}
+		if genericError.Goroutines != nil {
+			addMetadata(metadata, GoroutinesKey, genericError.Goroutines)
+		}
+		if genericError.Resources != nil {
+			addMetadata(metadata, ResourcesKey, genericError.Resources)
+		}
+	}
+	st := status.New(ToCode(err.Type()), genericError.Message)
+	detailed, detailsErr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   derrors.ErrorTypeAsString(err.Type()),
+		Domain:   Domain,
+		Metadata: metadata,
+	})
+	if detailsErr != nil {
+		return st
+	}
+	return detailed
+}
+
+// FromStatus transforms a gRPC status into an Error. If the status contains the details of a derrors error, an
+// equivalent GenericError is reconstructed. Otherwise the error type is obtained from the status code. A nil or
+// OK status returns nil.
+func FromStatus(st *status.Status) derrors.Error {
+	if st == nil || st.Code() == codes.OK {
+		return nil
+	}
+	result := &derrors.GenericError{
+		ErrorType:  FromCode(st.Code()),
+		Message:    st.Message(),
+		Parameters: make([]string, 0),
+		Causes:     make([]derrors.Cause, 0),
+		Stack:      make([]derrors.StackEntry, 0),
+	}
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.GetDomain() != Domain {
+			continue
+		}
+		if errorType, exists := derrors.ErrorTypesValues[info.GetReason()]; exists {
+			result.ErrorType = errorType
+		}
+		metadata := info.GetMetadata()
+		if message, exists := metadata[MessageKey]; exists {
+			result.Message = message
+		}
+		result.Instance = metadata[InstanceKey]
+		readMetadata(metadata, ParametersKey, &result.Parameters)
+		readMetadata(metadata, FieldsKey, &result.Fields)
+		readMetadata(metadata, NotesKey, &result.Notes)
+		readMetadata(metadata, MetadataKey, &result.Metadata)
+		readMetadata(metadata, CausesKey, &result.Causes)
+		readMetadata(metadata, StackTraceKey, &result.Stack)
+		readMetadata(metadata, GoroutineKey, &result.Goroutine)
+		readMetadata(metadata, GoroutinesKey, &result.Goroutines)
+		readMetadata(metadata, ResourcesKey, &result.Resources)
+		var parent *derrors.GenericError
+		if readMetadata(metadata, ParentKey, &parent) && parent != nil {
+			result.Parent = parent
+		}
+		break
+	}
+	return result
+}
+
+// addMetadata adds the JSON representation of a value to the metadata.
+func addMetadata(metadata map[string]string, key string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	metadata[key] = string(data)
+}
+
+// readMetadata unmarshals a metadata value if present. It returns true if the value was read.
+func readMetadata(metadata map[string]string, key string, target interface{}) bool {
+	data, exists := metadata[key]
+	if !exists {
+		return false
+	}
+	return json.Unmarshal([]byte(data), target) == nil
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package grpcx
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/nalej/derrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCodeMapping(t *testing.T) {
+	for errorType := range derrors.ErrorTypeNames {
+		code, exists := ErrorTypeCodes[errorType]
+		if !exists {
+			t.Errorf("missing code for %s", derrors.ErrorTypeAsString(errorType))
+		}
+		if FromCode(code) != errorType {
+			t.Errorf("expecting %s from code %s", derrors.ErrorTypeAsString(errorType), code)
+		}
+	}
+	if FromCode(codes.DataLoss) != derrors.Internal {
+		t.Error("expecting data loss to be an internal error")
+	}
+}
+
+func TestToStatus(t *testing.T) {
+	err := derrors.NewNotFoundError("entity not found", errors.New("no rows")).WithParams("id1").
+		CausedBy(derrors.NewUnavailableError("cannot connect"))
+	err = err.WithField("stackTrace", "user value").WithField("callback", func() {})
+	err.Metadata = map[string]string{"tenant": "acme"}
+	err.Goroutine = &derrors.GoroutineInfo{ID: 7}
+	err.Resources = derrors.CaptureResources()
+	st := ToStatus(err)
+	if st.Code() != codes.NotFound {
+		t.Errorf("expecting not found code, got %s", st.Code())
+	}
+	if st.Message() != "entity not found" {
+		t.Errorf("expecting error message, got %s", st.Message())
+	}
+
+	recovered := FromStatus(st).(*derrors.GenericError)
+	if recovered.Type() != derrors.NotFound || recovered.Message != err.Message {
+		t.Errorf("expecting equivalent error, got %s", recovered.Error())
+	}
+	if !reflect.DeepEqual(err.Parameters, recovered.Parameters) {
+		t.Errorf("expecting parameters, got %v", recovered.Parameters)
+	}
+	if value, _ := recovered.Field("stackTrace"); string(value) != `"user value"` {
+		t.Errorf("expecting fields, got %v", recovered.Fields)
+	}
+	if !reflect.DeepEqual(err.Notes, recovered.Notes) || len(recovered.Notes) == 0 {
+		t.Errorf("expecting notes, got %v", recovered.Notes)
+	}
+	if !reflect.DeepEqual(err.Metadata, recovered.Metadata) {
+		t.Errorf("expecting metadata, got %v", recovered.Metadata)
+	}
+	if recovered.InstanceID() != err.InstanceID() {
+		t.Errorf("expecting instance %s, got %s", err.InstanceID(), recovered.InstanceID())
+	}
+	if len(recovered.Causes) != 1 || recovered.Causes[0].Foreign.Message != "no rows" {
+		t.Errorf("expecting causes, got %v", recovered.Causes)
+	}
+	if recovered.Parent == nil || recovered.Parent.Type() != derrors.Unavailable {
+		t.Error("expecting parent")
+	}
+	if len(recovered.StackTrace()) != 0 || len(recovered.Parent.StackTrace()) != 0 {
+		t.Error("stack must not be included by default")
+	}
+	if recovered.Goroutine != nil || recovered.Resources != nil {
+		t.Error("goroutine and resources must not be included by default")
+	}
+}
+
+func TestToStatusWithStack(t *testing.T) {
+	err := derrors.NewInternalError("operation failed").CausedBy(derrors.NewUnavailableError("cannot connect")).
+		WithGoroutineDump()
+	err.Goroutine = &derrors.GoroutineInfo{ID: 7}
+	err.Resources = derrors.CaptureResources()
+	recovered := FromStatus(ToStatus(err, WithStack())).(*derrors.GenericError)
+	if !reflect.DeepEqual(err.StackTrace(), recovered.StackTrace()) {
+		t.Error("expecting stack")
+	}
+	if !reflect.DeepEqual(err.Goroutine, recovered.Goroutine) {
+		t.Errorf("expecting goroutine, got %v", recovered.Goroutine)
+	}
+	if recovered.Goroutines == nil || recovered.Goroutines.Goroutines != err.Goroutines.Goroutines {
+		t.Errorf("expecting goroutine dump, got %v", recovered.Goroutines)
+	}
+	if !reflect.DeepEqual(err.Resources, recovered.Resources) {
+		t.Errorf("expecting resources, got %v", recovered.Resources)
+	}
+	if !reflect.DeepEqual(err.Parent.StackTrace(), recovered.Parent.StackTrace()) {
+		t.Error("expecting parent with stack")
+	}
+}
+
+func TestToStatusKeepsDebugNamedFields(t *testing.T) {
+	derrors.SetCaptureGoroutine(true)
+	defer derrors.SetCaptureGoroutine(false)
+	parent := derrors.NewUnavailableError("cannot connect").
+		WithField("resources", map[string]int{"connections": 3}).WithField("stackTrace", "user").
+		WithField("goroutine", 7)
+	err := derrors.NewInternalError("operation failed", parent).CausedBy(parent)
+	recovered := FromStatus(ToStatus(err)).(*derrors.GenericError)
+	for _, nested := range []*derrors.GenericError{recovered.Parent.(*derrors.GenericError), recovered.Causes[0].Error} {
+		if value, _ := nested.Field("resources"); string(value) != `{"connections":3}` {
+			t.Errorf("expecting resources field, got %s", value)
+		}
+		if value, _ := nested.Field("stackTrace"); string(value) != `"user"` {
+			t.Errorf("expecting stackTrace field, got %s", value)
+		}
+		if value, _ := nested.Field("goroutine"); string(value) != "7" {
+			t.Errorf("expecting goroutine field, got %s", value)
+		}
+		if len(nested.StackTrace()) != 0 || nested.Goroutine != nil {
+			t.Error("debug information must not be included by default")
+		}
+	}
+	if parent.Goroutine == nil || len(parent.StackTrace()) == 0 {
+		t.Error("the original error must not be modified")
+	}
+}
+
+type customError struct {
+	*derrors.GenericError
+}
+
+func (ce *customError) Error() string {
+	return "[custom] " + ce.GenericError.Error()
+}
+
+func TestToStatusInspector(t *testing.T) {
+	err := &customError{derrors.NewNotFoundError("entity not found").WithField("id", "id1")}
+	recovered := FromStatus(ToStatus(err)).(*derrors.GenericError)
+	if recovered.Message != "entity not found" {
+		t.Errorf("expecting message of the error, got %s", recovered.Message)
+	}
+	if value, _ := recovered.Field("id"); string(value) != `"id1"` {
+		t.Errorf("expecting fields of the error, got %v", recovered.Fields)
+	}
+}
+
+func TestFromStatusWithoutDetails(t *testing.T) {
+	recovered := FromStatus(status.New(codes.PermissionDenied, "not allowed"))
+	if recovered.Type() != derrors.PermissionDenied {
+		t.Errorf("expecting permission denied, got %s", recovered.Error())
+	}
+	if recovered.Error() != "[PermissionDenied] not allowed" {
+		t.Errorf("expecting status message, got %s", recovered.Error())
+	}
+	if FromStatus(status.New(codes.OK, "")) != nil || FromStatus(nil) != nil {
+		t.Error("expecting no error")
+	}
+	if ToStatus(nil) != nil {
+		t.Error("expecting no status")
+	}
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// HTTP handler adapter for functions returning an Error.
+
+package derrors
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Media types supported when rendering an error.
+const (
+	JSONMediaType    = "application/json"
+	ProblemMediaType = "application/problem+json"
+	TextMediaType    = "text/plain"
+)
+
+// HandlerFunc defines the signature of an HTTP handler function that returns an Error. The function is
+// expected to write the response only if no error is returned.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) Error
+
+// ServeHTTP calls the function and writes the resulting error without exposing the stack or the parameters.
+func (f HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(&ErrorHandler{Handler: f}).ServeHTTP(w, r)
+}
+
+// ErrorHandler structure that adapts a HandlerFunc into an http.Handler. The errors returned by the function are
+// written in the format requested by the Accept header, and panics are recovered as Internal errors.
+type ErrorHandler struct {
+	// Handler function to be called.
+	Handler HandlerFunc
+	// ExposeStack includes the stack traces in the responses.
+	ExposeStack bool
+	// ExposeParameters includes the parameters in the responses.
+	ExposeParameters bool
+	// OnError is called, if set, with every error returned by the handler function or recovered from a panic,
+	// including those that cannot be written because the response was already started.
+	OnError func(r *http.Request, err Error)
+}
+
+// NewErrorHandler creates a new ErrorHandler for a given function.
+func NewErrorHandler(handler HandlerFunc, exposeStack bool, exposeParameters bool) *ErrorHandler {
+	return &ErrorHandler{Handler: handler, ExposeStack: exposeStack, ExposeParameters: exposeParameters}
+}
+
+// PanicMessage is the message of the Internal errors that report a panic of the handler. The value of the panic is
+// recorded in the PanicField field, so it is only exposed with the parameters.
+const PanicMessage = "unexpected panic while handling the request"
+
+// PanicField is the name of the field that contains the value of a recovered panic.
+const PanicField = "panic"
+
+// ServeHTTP calls the handler function and writes the resulting error if any. The error is not written if the
+// handler already started writing the response, as the status code cannot be changed anymore, although it is still
+// reported to OnError. A panic after the response was started aborts it with http.ErrAbortHandler so the client
+// does not take a truncated response as a success.
+func (eh *ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tracked := &trackingResponseWriter{ResponseWriter: w}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			err := NewInternalError(PanicMessage).WithField(PanicField, fmt.Sprint(recovered))
+			eh.reportError(r, err)
+			if tracked.written {
+				panic(http.ErrAbortHandler)
+			}
+			eh.WriteError(w, r, err)
+		}
+	}()
+	if err := eh.Handler(tracked, r); err != nil {
+		eh.reportError(r, err)
+		if !tracked.written {
+			eh.WriteError(w, r, err)
+		}
+	}
+}
+
+// reportError calls the OnError function, if set.
+func (eh *ErrorHandler) reportError(r *http.Request, err Error) {
+	if eh.OnError != nil {
+		eh.OnError(r, err)
+	}
+}
+
+// trackingResponseWriter structure that records if the response has been written.
+type trackingResponseWriter struct {
+	http.ResponseWriter
+	// written indicates that the status code or part of the body has been written.
+	written bool
+}
+
+// WriteHeader writes the status code of the response.
+func (trw *trackingResponseWriter) WriteHeader(statusCode int) {
+	trw.written = true
+	trw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write writes part of the body of the response.
+func (trw *trackingResponseWriter) Write(data []byte) (int, error) {
+	trw.written = true
+	return trw.ResponseWriter.Write(data)
+}
+
+// Flush sends the buffered data to the client if supported by the underlying writer.
+func (trw *trackingResponseWriter) Flush() {
+	if flusher, ok := trw.ResponseWriter.(http.Flusher); ok {
+		trw.written = true
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer so http.ResponseController can access its features.
+func (trw *trackingResponseWriter) Unwrap() http.ResponseWriter {
+	return trw.ResponseWriter
+}
+
+// WriteError writes an error in the format requested by the Accept header of the request.
+func (eh *ErrorHandler) WriteError(w http.ResponseWriter, r *http.Request, err Error) {
+	exposed := ToGenericError(err).Sanitize(eh.ExposeStack, eh.ExposeParameters)
+	statusCode := ToHTTPStatus(err.Type())
+	var body []byte
+	mediaType := negotiateMediaType(r.Header.Get("Accept"))
+	switch mediaType {
+	case TextMediaType:
+		body = []byte(exposed.textReport(eh.ExposeStack, eh.ExposeParameters))
+	case ProblemMediaType:
+		body, _ = json.Marshal(ToProblem(exposed))
+	default:
+		body, _ = json.Marshal(exposed)
+	}
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+// textReport returns the plain text representation of an error.
+func (ge *GenericError) textReport(withStack bool, withParameters bool) string {
+	if withStack {
+		return ge.DebugReport()
+	}
+	if withParameters {
+		return ge.Error() + "\n" + ge.paramsToString() + ge.notesToString() + ge.metadataToString()
+	}
+	return ge.Error() + "\n"
+}
+
+// Sanitize returns a copy of the error chain optionally removing the stack traces, together with the related debug
+// information, and the parameters together with the metadata. The receiver is not modified.
+func (ge *GenericError) Sanitize(withStack bool, withParameters bool) *GenericError {
+	result := *ge
+	if !withStack {
+		result.Stack = make([]StackEntry, 0)
+		result.RawStack = nil
+		result.Goroutine = nil
+		result.Goroutines = nil
+		result.Resources = nil
+		result.callers = nil
+	}
+	if !withParameters {
+		result.Parameters = make([]string, 0)
+		result.Fields = nil
+		result.Notes = nil
+		result.Metadata = nil
+	}
+	result.Causes = make([]Cause, len(ge.Causes))
+	for i, cause := range ge.Causes {
+		result.Causes[i] = cause
+		if cause.Error != nil {
+			result.Causes[i] = cause.withError(cause.Error.Sanitize(withStack, withParameters))
+		}
+	}
+	if !isNilError(ge.Parent) {
+		result.Parent = ToGenericError(ge.Parent).Sanitize(withStack, withParameters)
+	}
+	return &result
+}
+
+// negotiateMediaType selects the media type used to render an error from the value of an Accept header. JSON is
+// used by default.
+func negotiateMediaType(accept string) string {
+	selected := JSONMediaType
+	selectedQuality := 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, exists := params["q"]; exists {
+			if value, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = value
+			}
+		}
+		candidate := ""
+		switch mediaType {
+		case ProblemMediaType, JSONMediaType, TextMediaType:
+			candidate = mediaType
+		case "application/*", "*/*":
+			candidate = JSONMediaType
+		case "text/*":
+			candidate = TextMediaType
+		}
+		if candidate != "" && quality > selectedQuality {
+			selected = candidate
+			selectedQuality = quality
+		}
+	}
+	return selected
+}
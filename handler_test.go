@@ -0,0 +1,154 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Handler adapter tests
+
+package derrors
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveError(handler http.Handler, accept string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/entity", nil)
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) Error {
+	return NewNotFoundError("entity not found").WithParams("id1")
+}
+
+func TestHandlerFuncJSON(t *testing.T) {
+	response := serveError(HandlerFunc(notFoundHandler), "")
+	assertEquals(t, http.StatusNotFound, response.Code, "expecting status code")
+	assertEquals(t, "application/json; charset=utf-8", response.Header().Get("Content-Type"), "expecting JSON")
+	recovered, err := FromJSON(response.Body.Bytes())
+	assertTrue(t, err == nil, "expecting derrors JSON")
+	assertEquals(t, "[NotFound] entity not found", recovered.Error(), "expecting error")
+	assertEquals(t, 0, len(recovered.StackTrace()), "stack must not be exposed")
+	assertEquals(t, 0, len(recovered.(*GenericError).Parameters), "parameters must not be exposed")
+}
+
+func TestHandlerFuncNoError(t *testing.T) {
+	response := serveError(HandlerFunc(func(w http.ResponseWriter, r *http.Request) Error {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}), "")
+	assertEquals(t, http.StatusNoContent, response.Code, "expecting handler status code")
+}
+
+func TestErrorHandlerExposed(t *testing.T) {
+	handler := NewErrorHandler(notFoundHandler, true, true)
+	response := serveError(handler, "application/json")
+	recovered, err := FromJSON(response.Body.Bytes())
+	assertTrue(t, err == nil, "expecting derrors JSON")
+	assertTrue(t, len(recovered.StackTrace()) > 0, "stack must be exposed")
+	assertEquals(t, 1, len(recovered.(*GenericError).Parameters), "parameters must be exposed")
+
+	response = serveError(handler, "text/plain")
+	assertEquals(t, "text/plain; charset=utf-8", response.Header().Get("Content-Type"), "expecting text")
+	assertTrue(t, strings.Contains(response.Body.String(), "StackTrace:"), "expecting debug report")
+}
+
+func TestErrorHandlerNegotiation(t *testing.T) {
+	handler := HandlerFunc(notFoundHandler)
+	response := serveError(handler, "text/html, application/problem+json;q=0.9, application/json;q=0.5")
+	assertEquals(t, "application/problem+json; charset=utf-8", response.Header().Get("Content-Type"),
+		"expecting problem")
+	problem := make(map[string]interface{})
+	assertTrue(t, json.Unmarshal(response.Body.Bytes(), &problem) == nil, "expecting JSON problem")
+	assertEquals(t, "entity not found", problem["detail"], "expecting problem detail")
+
+	response = serveError(handler, "text/*")
+	assertEquals(t, "[NotFound] entity not found\n", response.Body.String(), "expecting error message")
+
+	response = serveError(handler, "image/png")
+	assertEquals(t, "application/json; charset=utf-8", response.Header().Get("Content-Type"), "expecting default")
+}
+
+func TestErrorHandlerPanic(t *testing.T) {
+	panicking := func(w http.ResponseWriter, r *http.Request) Error {
+		panic("unexpected failure in /internal/path")
+	}
+	response := serveError(NewErrorHandler(panicking, true, true), "")
+	assertEquals(t, http.StatusInternalServerError, response.Code, "expecting internal error")
+	recovered, err := FromJSON(response.Body.Bytes())
+	assertTrue(t, err == nil, "expecting derrors JSON")
+	assertEquals(t, "[Internal] "+PanicMessage, recovered.Error(), "expecting panic message")
+	var value string
+	assertTrue(t, recovered.(*GenericError).FieldValue(PanicField, &value), "expecting panic field")
+	assertEquals(t, "unexpected failure in /internal/path", value, "expecting panic value")
+	assertTrue(t, len(recovered.StackTrace()) > 0, "expecting panic stack")
+
+	hidden := serveError(HandlerFunc(panicking), "")
+	assertEquals(t, http.StatusInternalServerError, hidden.Code, "expecting internal error")
+	assertTrue(t, !strings.Contains(hidden.Body.String(), "/internal/path"), "panic value must not be exposed")
+}
+
+func TestErrorHandlerAfterWriting(t *testing.T) {
+	reported := make([]Error, 0)
+	onError := func(r *http.Request, err Error) {
+		reported = append(reported, err)
+	}
+	written := func(w http.ResponseWriter, r *http.Request) Error {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		return NewInternalError("failed after writing")
+	}
+	response := serveError(&ErrorHandler{Handler: written, OnError: onError}, "")
+	assertEquals(t, http.StatusAccepted, response.Code, "status must not be overwritten")
+	assertEquals(t, "partial", response.Body.String(), "body must not be mixed")
+	assertEquals(t, 1, len(reported), "expecting reported error")
+	assertEquals(t, "[Internal] failed after writing", reported[0].Error(), "expecting handler error")
+
+	panicking := func(w http.ResponseWriter, r *http.Request) Error {
+		w.Write([]byte("partial"))
+		panic("unexpected failure")
+	}
+	var recovered interface{}
+	func() {
+		defer func() {
+			recovered = recover()
+		}()
+		serveError(&ErrorHandler{Handler: panicking, OnError: onError}, "")
+	}()
+	assertEquals(t, http.ErrAbortHandler, recovered, "expecting aborted response")
+	assertEquals(t, 2, len(reported), "expecting reported panic")
+	assertEquals(t, Internal, reported[1].Type(), "expecting internal error")
+	assertTrue(t, reported[1].(*GenericError).FieldValue(PanicField, new(string)), "expecting panic value")
+}
+
+func TestErrorHandlerOnError(t *testing.T) {
+	reported := make([]Error, 0)
+	handler := NewErrorHandler(notFoundHandler, false, false)
+	handler.OnError = func(r *http.Request, err Error) {
+		reported = append(reported, err)
+	}
+	response := serveError(handler, "")
+	assertEquals(t, http.StatusNotFound, response.Code, "expecting status code")
+	assertEquals(t, 1, len(reported), "expecting reported error")
+	assertEquals(t, 1, len(reported[0].(*GenericError).Parameters), "reported error must not be sanitized")
+}
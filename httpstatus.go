@@ -0,0 +1,157 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Mapping between error types and HTTP status codes.
+
+package derrors
+
+import (
+	"net/http"
+	"sync"
+)
+
+// StatusClientClosedRequest is the non standard status code used when the client cancels the request.
+const StatusClientClosedRequest = 499
+
+// ErrorTypeHTTPStatus map associating error types with HTTP status codes.
+var ErrorTypeHTTPStatus = map[ErrorType]int{
+	Generic:            http.StatusInternalServerError,
+	Canceled:           StatusClientClosedRequest,
+	InvalidArgument:    http.StatusBadRequest,
+	DeadlineExceeded:   http.StatusGatewayTimeout,
+	NotFound:           http.StatusNotFound,
+	AlreadyExists:      http.StatusConflict,
+	PermissionDenied:   http.StatusForbidden,
+	ResourceExhausted:  http.StatusTooManyRequests,
+	FailedPrecondition: http.StatusBadRequest,
+	Aborted:            http.StatusConflict,
+	OutOfRange:         http.StatusBadRequest,
+	Unimplemented:      http.StatusNotImplemented,
+	Internal:           http.StatusInternalServerError,
+	Unavailable:        http.StatusServiceUnavailable,
+	Unauthenticated:    http.StatusUnauthorized,
+}
+
+// HTTPStatusErrorTypes map associating HTTP status codes with error types.
+var HTTPStatusErrorTypes = map[int]ErrorType{
+	http.StatusBadRequest:                    InvalidArgument,
+	http.StatusUnauthorized:                  Unauthenticated,
+	http.StatusPaymentRequired:               PermissionDenied,
+	http.StatusForbidden:                     PermissionDenied,
+	http.StatusNotFound:                      NotFound,
+	http.StatusMethodNotAllowed:              Unimplemented,
+	http.StatusNotAcceptable:                 InvalidArgument,
+	http.StatusProxyAuthRequired:             Unauthenticated,
+	http.StatusRequestTimeout:                DeadlineExceeded,
+	http.StatusConflict:                      AlreadyExists,
+	http.StatusGone:                          NotFound,
+	http.StatusLengthRequired:                InvalidArgument,
+	http.StatusPreconditionFailed:            FailedPrecondition,
+	http.StatusRequestEntityTooLarge:         OutOfRange,
+	http.StatusRequestURITooLong:             InvalidArgument,
+	http.StatusUnsupportedMediaType:          InvalidArgument,
+	http.StatusRequestedRangeNotSatisfiable:  OutOfRange,
+	http.StatusExpectationFailed:             FailedPrecondition,
+	http.StatusTeapot:                        Unimplemented,
+	http.StatusMisdirectedRequest:            Unavailable,
+	http.StatusUnprocessableEntity:           InvalidArgument,
+	http.StatusLocked:                        FailedPrecondition,
+	http.StatusFailedDependency:              FailedPrecondition,
+	http.StatusTooEarly:                      Unavailable,
+	http.StatusUpgradeRequired:               FailedPrecondition,
+	http.StatusPreconditionRequired:          FailedPrecondition,
+	http.StatusTooManyRequests:               ResourceExhausted,
+	http.StatusRequestHeaderFieldsTooLarge:   InvalidArgument,
+	http.StatusUnavailableForLegalReasons:    PermissionDenied,
+	StatusClientClosedRequest:                Canceled,
+	http.StatusInternalServerError:           Internal,
+	http.StatusNotImplemented:                Unimplemented,
+	http.StatusBadGateway:                    Unavailable,
+	http.StatusServiceUnavailable:            Unavailable,
+	http.StatusGatewayTimeout:                DeadlineExceeded,
+	http.StatusHTTPVersionNotSupported:       Unimplemented,
+	http.StatusVariantAlsoNegotiates:         Internal,
+	http.StatusInsufficientStorage:           ResourceExhausted,
+	http.StatusLoopDetected:                  Internal,
+	http.StatusNotExtended:                   Unimplemented,
+	http.StatusNetworkAuthenticationRequired: Unauthenticated,
+}
+
+// httpOverrides contains the mappings defined by the application that take precedence over the default ones.
+var httpOverrides = struct {
+	sync.RWMutex
+	statusCodes map[ErrorType]int
+	errorTypes  map[int]ErrorType
+}{statusCodes: make(map[ErrorType]int), errorTypes: make(map[int]ErrorType)}
+
+// OverrideHTTPStatus changes the HTTP status code associated with an error type.
+func OverrideHTTPStatus(errorType ErrorType, statusCode int) {
+	httpOverrides.Lock()
+	defer httpOverrides.Unlock()
+	httpOverrides.statusCodes[errorType] = statusCode
+}
+
+// OverrideErrorType changes the error type associated with an HTTP status code.
+func OverrideErrorType(statusCode int, errorType ErrorType) {
+	httpOverrides.Lock()
+	defer httpOverrides.Unlock()
+	httpOverrides.errorTypes[statusCode] = errorType
+}
+
+// ResetHTTPOverrides removes all the mappings defined with OverrideHTTPStatus and OverrideErrorType.
+func ResetHTTPOverrides() {
+	httpOverrides.Lock()
+	defer httpOverrides.Unlock()
+	httpOverrides.statusCodes = make(map[ErrorType]int)
+	httpOverrides.errorTypes = make(map[int]ErrorType)
+}
+
+// ToHTTPStatus returns the HTTP status code associated with an error type. Unknown error types are
+// mapped to Internal Server Error.
+func ToHTTPStatus(errorType ErrorType) int {
+	httpOverrides.RLock()
+	statusCode, exists := httpOverrides.statusCodes[errorType]
+	httpOverrides.RUnlock()
+	if exists {
+		return statusCode
+	}
+	if statusCode, exists := ErrorTypeHTTPStatus[errorType]; exists {
+		return statusCode
+	}
+	return http.StatusInternalServerError
+}
+
+// FromHTTPStatus returns the error type associated with an HTTP status code. Unknown 4xx status codes are mapped to
+// InvalidArgument, unknown 5xx status codes are mapped to Internal and any other status code is mapped to Generic.
+func FromHTTPStatus(statusCode int) ErrorType {
+	httpOverrides.RLock()
+	errorType, exists := httpOverrides.errorTypes[statusCode]
+	httpOverrides.RUnlock()
+	if exists {
+		return errorType
+	}
+	if errorType, exists := HTTPStatusErrorTypes[statusCode]; exists {
+		return errorType
+	}
+	switch {
+	case statusCode >= 400 && statusCode < 500:
+		return InvalidArgument
+	case statusCode >= 500 && statusCode < 600:
+		return Internal
+	}
+	return Generic
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// HTTP status mapping tests
+
+package derrors
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestToHTTPStatus(t *testing.T) {
+	for errorType := range ErrorTypeNames {
+		_, exists := ErrorTypeHTTPStatus[errorType]
+		assertTrue(t, exists, "expecting status for "+ErrorTypeAsString(errorType))
+	}
+	assertEquals(t, 499, ToHTTPStatus(Canceled), "expecting client closed request")
+	assertEquals(t, http.StatusTooManyRequests, ToHTTPStatus(ResourceExhausted), "expecting too many requests")
+	assertEquals(t, http.StatusServiceUnavailable, ToHTTPStatus(Unavailable), "expecting service unavailable")
+	assertEquals(t, http.StatusInternalServerError, ToHTTPStatus(ErrorType(100)), "expecting default status")
+}
+
+func TestFromHTTPStatus(t *testing.T) {
+	for statusCode := 400; statusCode < 600; statusCode++ {
+		if http.StatusText(statusCode) != "" {
+			_, exists := HTTPStatusErrorTypes[statusCode]
+			assertTrue(t, exists, "expecting error type for "+http.StatusText(statusCode))
+		}
+	}
+	for errorType, statusCode := range ErrorTypeHTTPStatus {
+		assertEquals(t, ErrorTypeHTTPStatus[FromHTTPStatus(statusCode)], statusCode,
+			"expecting consistent mapping for "+ErrorTypeAsString(errorType))
+	}
+	assertEquals(t, FailedPrecondition, FromHTTPStatus(http.StatusPreconditionFailed), "expecting precondition")
+	assertEquals(t, InvalidArgument, FromHTTPStatus(460), "expecting default client error")
+	assertEquals(t, Internal, FromHTTPStatus(560), "expecting default server error")
+	assertEquals(t, Generic, FromHTTPStatus(http.StatusOK), "expecting generic error")
+}
+
+func TestHTTPOverrides(t *testing.T) {
+	defer ResetHTTPOverrides()
+	OverrideHTTPStatus(FailedPrecondition, http.StatusPreconditionFailed)
+	OverrideErrorType(http.StatusBadGateway, Internal)
+	assertEquals(t, http.StatusPreconditionFailed, ToHTTPStatus(FailedPrecondition), "expecting override")
+	assertEquals(t, Internal, FromHTTPStatus(http.StatusBadGateway), "expecting override")
+	assertEquals(t, http.StatusPreconditionFailed, ToProblem(NewFailedPreconditionError("msg")).Status,
+		"expecting override on problems")
+	ResetHTTPOverrides()
+	assertEquals(t, http.StatusBadRequest, ToHTTPStatus(FailedPrecondition), "expecting default mapping")
+	assertEquals(t, Unavailable, FromHTTPStatus(http.StatusBadGateway), "expecting default mapping")
+}
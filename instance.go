@@ -0,0 +1,63 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Identification of the occurrences of the errors.
+
+package derrors
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
+
+// instanceID structure that contains the identifier of an occurrence of an error. The identifier is generated the
+// first time it is requested, and it is shared by the copies of the error.
+type instanceID struct {
+	once sync.Once
+	id   string
+}
+
+// get returns the identifier, generating it on the first call.
+func (iid *instanceID) get() string {
+	iid.once.Do(func() {
+		iid.id = newInstanceID()
+	})
+	return iid.id
+}
+
+// InstanceID returns a URI that identifies the occurrence of the error. The identifier is generated the first time
+// it is requested, and kept on the copies created by the With methods and on the JSON representation. It returns
+// an empty string for errors recovered from a representation without identifier.
+func (ge *GenericError) InstanceID() string {
+	if ge.Instance == "" && ge.instance != nil {
+		return ge.instance.get()
+	}
+	return ge.Instance
+}
+
+// newInstanceID generates a random URN identifying an occurrence of an error.
+func newInstanceID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return ""
+	}
+	// Set the version and variant of a random UUID.
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Instance identifier tests
+
+package derrors
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestInstanceID(t *testing.T) {
+	err := NewNotFoundError("entity not found")
+	id := err.InstanceID()
+	assertTrue(t, strings.HasPrefix(id, "urn:uuid:"), "expecting instance identifier")
+	assertEquals(t, id, err.InstanceID(), "expecting stable instance identifier")
+	assertEquals(t, id, err.WithParams("id1").InstanceID(), "expecting same identifier on copies")
+	assertTrue(t, id != NewNotFoundError("entity not found").InstanceID(), "expecting unique instance identifier")
+
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertEquals(t, id, recovered.(*GenericError).InstanceID(), "expecting serialized identifier")
+}
+
+func TestInstanceIDPreviousVersion(t *testing.T) {
+	data := []byte(`{"errorType":1,"message":"msg","parameters":[],"causes":[],"parent":null,"stackTrace":[]}`)
+	recovered, err := FromJSON(data)
+	assertTrue(t, err == nil, "deserialization must work")
+	assertEquals(t, "", recovered.(*GenericError).InstanceID(), "expecting no identifier")
+}
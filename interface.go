@@ -19,6 +19,8 @@
 
 package derrors
 
+import "encoding/json"
+
 // Error defines the interface for all Daisho-defined errors.
 type Error interface {
 	// Error returns the string representation of the error. Notice that this particular method is required
@@ -33,3 +35,40 @@ type Error interface {
 	// StackTraceAsString returns the stack trace elements as a string array.
 	StackTraceAsString() []string
 }
+
+// Inspector defines the interface of the errors that expose their elements. It permits to read the elements of an
+// error without type asserting it to a GenericError.
+type Inspector interface {
+	Error
+	// ErrorMessage returns the message of the error without the type.
+	ErrorMessage() string
+	// ErrorParameters returns the JSON representation of the positional parameters of the error.
+	ErrorParameters() []string
+	// ErrorFields returns the JSON representation of the named parameters of the error.
+	ErrorFields() map[string]json.RawMessage
+	// ErrorCauses returns the original errors that caused the error.
+	ErrorCauses() []error
+	// ParentError returns the parent error, if any.
+	ParentError() (Error, error)
+}
+
+// Decorator defines the interface of the errors that can be decorated with extra information. The decorators return
+// a new error without modifying the receiver.
+type Decorator interface {
+	Error
+	// DecorateParams returns a copy of the error with extra positional parameters.
+	DecorateParams(params ...interface{}) ExtendedError
+	// DecorateField returns a copy of the error with a named parameter.
+	DecorateField(name string, value interface{}) ExtendedError
+	// DecorateFields returns a copy of the error with a set of named parameters.
+	DecorateFields(fields map[string]interface{}) ExtendedError
+	// DecorateParent returns a copy of the error linked with a parent error.
+	DecorateParent(parent Error) ExtendedError
+}
+
+// ExtendedError defines the interface of the errors that can be fully inspected and decorated, so alternative
+// implementations and mocks can be used wherever a GenericError is expected.
+type ExtendedError interface {
+	Inspector
+	Decorator
+}
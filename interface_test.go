@@ -0,0 +1,142 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Extended interface tests
+
+package derrors
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// mockError is an alternative implementation of ExtendedError.
+type mockError struct {
+	message string
+	params  []string
+	fields  map[string]json.RawMessage
+	parent  Error
+}
+
+func (me *mockError) Error() string                { return "[FailedPrecondition] " + me.message }
+func (me *mockError) Type() ErrorType              { return FailedPrecondition }
+func (me *mockError) DebugReport() string          { return me.message }
+func (me *mockError) StackTrace() []StackEntry     { return make([]StackEntry, 0) }
+func (me *mockError) StackTraceAsString() []string { return make([]string, 0) }
+func (me *mockError) ErrorMessage() string         { return me.message }
+func (me *mockError) ErrorParameters() []string    { return me.params }
+func (me *mockError) ErrorCauses() []error         { return []error{errors.New("mock cause")} }
+func (me *mockError) ParentError() (Error, error)  { return me.parent, nil }
+func (me *mockError) ErrorFields() map[string]json.RawMessage {
+	return me.fields
+}
+
+func (me *mockError) DecorateParams(params ...interface{}) ExtendedError {
+	result := *me
+	result.params = append([]string{}, me.params...)
+	for _, param := range params {
+		data, _ := marshalParameter(param)
+		result.params = append(result.params, string(data))
+	}
+	return &result
+}
+
+func (me *mockError) DecorateField(name string, value interface{}) ExtendedError {
+	return me.DecorateFields(map[string]interface{}{name: value})
+}
+
+func (me *mockError) DecorateFields(fields map[string]interface{}) ExtendedError {
+	result := *me
+	result.fields = make(map[string]json.RawMessage)
+	for name, value := range me.fields {
+		result.fields[name] = value
+	}
+	for name, value := range fields {
+		result.fields[name], _ = marshalParameter(value)
+	}
+	return &result
+}
+
+func (me *mockError) DecorateParent(parent Error) ExtendedError {
+	result := *me
+	result.parent = parent
+	return &result
+}
+
+// decorate uses the extended interface as a library function receiving any implementation would.
+func decorate(err ExtendedError) ExtendedError {
+	return err.DecorateParams("p0").DecorateField("orgID", "org1").
+		DecorateParent(NewUnavailableError("cannot connect"))
+}
+
+func TestExtendedError(t *testing.T) {
+	var err ExtendedError = NewInternalError("operation failed", errors.New("cause"))
+	decorated := decorate(err)
+	assertEquals(t, "operation failed", decorated.ErrorMessage(), "expecting message")
+	assertEquals(t, []string{`"p0"`}, decorated.ErrorParameters(), "expecting parameters")
+	assertEquals(t, `"org1"`, string(decorated.ErrorFields()["orgID"]), "expecting fields")
+	assertEquals(t, 1, len(decorated.ErrorCauses()), "expecting causes")
+	assertEquals(t, "cause", decorated.ErrorCauses()[0].Error(), "expecting cause")
+	parent, _ := decorated.ParentError()
+	assertEquals(t, Unavailable, parent.Type(), "expecting parent")
+	assertEquals(t, 0, len(err.ErrorParameters()), "the original error must not change")
+	assertEquals(t, 0, len(err.ErrorFields()), "the original error must not change")
+
+	decorated.ErrorParameters()[0] = "modified"
+	assertEquals(t, []string{`"p0"`}, decorated.ErrorParameters(), "accessors must return copies")
+}
+
+func TestAlternativeImplementation(t *testing.T) {
+	mock := decorate(&mockError{message: "mock failure"})
+	assertEquals(t, []string{`"p0"`}, mock.ErrorParameters(), "expecting parameters")
+
+	err := NewInternalError("operation failed").CausedBy(mock)
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	recoveredParent := recovered.(*GenericError).Parent.(*GenericError)
+	assertEquals(t, FailedPrecondition, recoveredParent.Type(), "expecting parent type")
+	assertEquals(t, "[FailedPrecondition] mock failure", recoveredParent.Error(), "expecting parent message")
+	assertEquals(t, []string{`"p0"`}, recoveredParent.Parameters, "expecting parent parameters")
+	assertEquals(t, `"org1"`, string(recoveredParent.Fields["orgID"]), "expecting parent fields")
+	assertEquals(t, "mock cause", recoveredParent.Causes[0].Foreign.Message, "expecting parent causes")
+	assertEquals(t, Unavailable, recoveredParent.Parent.Type(), "expecting grandparent")
+}
+
+// basicError is an implementation of Error that does not expose its elements.
+type basicError struct {
+	message string
+}
+
+func (be *basicError) Error() string                { return "[Unavailable] " + be.message }
+func (be *basicError) Type() ErrorType              { return Unavailable }
+func (be *basicError) DebugReport() string          { return be.message }
+func (be *basicError) StackTrace() []StackEntry     { return make([]StackEntry, 0) }
+func (be *basicError) StackTraceAsString() []string { return make([]string, 0) }
+
+func TestBasicImplementation(t *testing.T) {
+	err := NewInternalError("operation failed").CausedBy(&basicError{"cannot connect"})
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	recoveredParent := recovered.(*GenericError).Parent.(*GenericError)
+	assertEquals(t, "cannot connect", recoveredParent.Message, "expecting message without type")
+	assertEquals(t, "[Unavailable] cannot connect", recoveredParent.Error(), "expecting parent message")
+}
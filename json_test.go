@@ -25,6 +25,48 @@ import (
 	"testing"
 )
 
+// assertSameStructure checks that two errors have the same serializable structure and the same elements. Causes
+// that are not derrors errors are recovered as ForeignError, so only their type name and message are compared.
+func assertSameStructure(t *testing.T, expected Error, current Error) {
+	expectedData, err := json.Marshal(expected)
+	assertEquals(t, nil, err, "expecting no error")
+	currentData, err := json.Marshal(current)
+	assertEquals(t, nil, err, "expecting no error")
+	assertEquals(t, string(expectedData), string(currentData), "structure should match")
+	assertSameError(t, ToGenericError(expected), ToGenericError(current))
+}
+
+// assertSameError checks that two errors have the same type, message, parameters, fields, stack, causes and parent.
+func assertSameError(t *testing.T, expected *GenericError, current *GenericError) {
+	t.Helper()
+	if expected == nil || current == nil {
+		assertTrue(t, expected == nil && current == nil, "both errors must be nil")
+		return
+	}
+	assertEquals(t, expected.ErrorType, current.ErrorType, "type should match")
+	assertEquals(t, expected.Message, current.Message, "message should match")
+	assertEquals(t, expected.Parameters, current.Parameters, "parameters should match")
+	assertEquals(t, expected.Fields, current.Fields, "fields should match")
+	assertEquals(t, expected.StackTrace(), current.StackTrace(), "stack trace should match")
+	assertEquals(t, len(expected.Causes), len(current.Causes), "number of causes should match")
+	for i := 0; i < len(expected.Causes) && i < len(current.Causes); i++ {
+		assertSameError(t, expected.Causes[i].Error, current.Causes[i].Error)
+		if expected.Causes[i].Foreign != nil {
+			assertTrue(t, current.Causes[i].Foreign != nil, "foreign cause should match")
+			assertEquals(t, expected.Causes[i].Foreign.String(), current.Causes[i].Foreign.String(),
+				"foreign cause should match")
+		}
+	}
+	var expectedParent, currentParent *GenericError
+	if expected.Parent != nil {
+		expectedParent = ToGenericError(expected.Parent)
+	}
+	if current.Parent != nil {
+		currentParent = ToGenericError(current.Parent)
+	}
+	assertSameError(t, expectedParent, currentParent)
+}
+
 func TestFromJsonGenericError(t *testing.T) {
 	cause := errors.New("error cause")
 	msg := "Error message"
@@ -36,7 +78,7 @@ func TestFromJsonGenericError(t *testing.T) {
 
 	assertEquals(t, nil, err, "message should be deserialized")
 	//assertEquals(t, GenericErrorType, retrieved.Type(), "type mismatch")
-	assertEquals(t, toSend, retrieved, "structure should match")
+	assertSameStructure(t, toSend, retrieved)
 }
 
 func TestFromJsonEntityError(t *testing.T) {
@@ -50,7 +92,7 @@ func TestFromJsonEntityError(t *testing.T) {
 	retrieved, err := FromJSON(data)
 
 	assertEquals(t, nil, err, "message should be deserialized")
-	assertEquals(t, toSend, retrieved, "structure should match")
+	assertSameStructure(t, toSend, retrieved)
 
 }
 
@@ -66,7 +108,7 @@ func TestFromJsonConnectionError(t *testing.T) {
 	retrieved, err := FromJSON(data)
 
 	assertEquals(t, nil, err, "message should be deserialized")
-	assertEquals(t, toSend, retrieved, "structure should match")
+	assertSameStructure(t, toSend, retrieved)
 
 }
 
@@ -84,6 +126,31 @@ func TestFromJsonOperationError(t *testing.T) {
 	retrieved, err := FromJSON(data)
 
 	assertEquals(t, nil, err, "message should be deserialized")
-	assertEquals(t, toSend, retrieved, "structure should match")
+	assertSameStructure(t, toSend, retrieved)
+
+}
 
+func TestFromJsonFields(t *testing.T) {
+	toSend := NewInvalidArgumentError("invalid request").WithParams("param1").
+		WithField("orgID", "org1").WithField("limits", []int{1, 2})
+
+	data, err := json.Marshal(toSend)
+	assertEquals(t, nil, err, "expecting no error")
+	retrieved, err := FromJSON(data)
+
+	assertEquals(t, nil, err, "message should be deserialized")
+	assertSameStructure(t, toSend, retrieved)
+	var limits []int
+	assertTrue(t, retrieved.(*GenericError).FieldValue("limits", &limits), "expecting field")
+	assertEquals(t, []int{1, 2}, limits, "expecting field value")
+}
+
+func TestFromJsonPositionalParameters(t *testing.T) {
+	data := []byte(`{"errorType":2,"message":"msg","parameters":["\"id1\"","3"],"causes":[],"parent":null,"stackTrace":[]}`)
+	retrieved, err := FromJSON(data)
+
+	assertEquals(t, nil, err, "message should be deserialized")
+	genericError := retrieved.(*GenericError)
+	assertEquals(t, []string{`"id1"`, "3"}, genericError.Parameters, "expecting positional parameters")
+	assertTrue(t, genericError.Fields == nil, "expecting no fields")
 }
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Safe serialization of the parameters of the errors.
+
+package derrors
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// DefaultParameterSize is the default maximum size in bytes of the JSON representation of a parameter.
+const DefaultParameterSize = 4096
+
+// minParameterSize is the minimum size in bytes that can be set as the limit of a parameter.
+const minParameterSize = 64
+
+// parameterSize contains the maximum size in bytes of the JSON representation of a parameter.
+var parameterSize = int32(DefaultParameterSize)
+
+// SetParameterSize sets the maximum size in bytes of the JSON representation of the parameters and fields. Larger
+// values are truncated and stored as a JSON string.
+func SetParameterSize(size int) {
+	if size < minParameterSize {
+		size = minParameterSize
+	}
+	atomic.StoreInt32(&parameterSize, int32(size))
+}
+
+// ParameterSize returns the maximum size in bytes of the JSON representation of the parameters and fields.
+func ParameterSize() int {
+	return int(atomic.LoadInt32(&parameterSize))
+}
+
+// marshalParameter returns the JSON representation of a parameter. It never panics: values that cannot be
+// marshalled are represented as a JSON string with their fmt representation, and values larger than ParameterSize
+// are truncated. It returns a note describing the fallback or the truncation, if any.
+func marshalParameter(value interface{}) (json.RawMessage, string) {
+	note := ""
+	data, err := safeMarshal(value)
+	if err != nil {
+		data, _ = json.Marshal(safeFormat(value))
+		note = fmt.Sprintf("cannot be marshalled (%s), using its fmt representation", err.Error())
+	}
+	if limit := ParameterSize(); len(data) > limit {
+		if note != "" {
+			note += ", "
+		}
+		note += fmt.Sprintf("truncated from %d to %d bytes", len(data), limit)
+		data, _ = json.Marshal(string(data[:limit]) + "...")
+	}
+	return data, note
+}
+
+// safeMarshal returns the JSON representation of a value recovering from panics in custom marshallers.
+func safeMarshal(value interface{}) (data []byte, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			data, err = nil, fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return json.Marshal(value)
+}
+
+// safeFormat returns the fmt representation of a value. Values with cycles through maps, slices or interfaces,
+// which cannot be formatted by fmt, are represented by their type.
+func safeFormat(value interface{}) string {
+	if isCyclic(reflect.ValueOf(value), 0, make(map[visitedValue]bool)) {
+		return fmt.Sprintf("%T (cyclic value)", value)
+	}
+	return fmt.Sprintf("%+v", value)
+}
+
+// visitedValue identifies a value that references other values.
+type visitedValue struct {
+	pointer   uintptr
+	valueType reflect.Type
+}
+
+// isCyclic checks if fmt would follow a cycle while formatting a value. As fmt only follows the pointers on the
+// top level, the pointers found on deeper levels are not inspected.
+func isCyclic(value reflect.Value, depth int, visiting map[visitedValue]bool) bool {
+	switch value.Kind() {
+	case reflect.Ptr:
+		return depth == 0 && !value.IsNil() && isCyclic(value.Elem(), depth+1, visiting)
+	case reflect.Interface:
+		return !value.IsNil() && isCyclic(value.Elem(), depth+1, visiting)
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if isCyclic(value.Field(i), depth+1, visiting) {
+				return true
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if isCyclic(value.Index(i), depth+1, visiting) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Map:
+		if value.IsNil() || value.Len() == 0 {
+			return false
+		}
+		key := visitedValue{value.Pointer(), value.Type()}
+		if visiting[key] {
+			return true
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+		if value.Kind() == reflect.Slice {
+			for i := 0; i < value.Len(); i++ {
+				if isCyclic(value.Index(i), depth+1, visiting) {
+					return true
+				}
+			}
+			return false
+		}
+		iterator := value.MapRange()
+		for iterator.Next() {
+			if isCyclic(iterator.Key(), depth+1, visiting) || isCyclic(iterator.Value(), depth+1, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Parameter serialization tests
+
+package derrors
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type panicMarshaller struct{}
+
+func (pm panicMarshaller) MarshalJSON() ([]byte, error) {
+	panic("marshaller failure")
+}
+
+type cyclicNode struct {
+	Name string
+	Next *cyclicNode
+}
+
+func TestWithParamsUnsupportedValues(t *testing.T) {
+	channel := make(chan int)
+	err := NewInternalError("operation failed").WithParams("id1", channel, func() {}, panicMarshaller{})
+	assertEquals(t, 4, len(err.Parameters), "all parameters must be recorded")
+	assertEquals(t, `"id1"`, err.Parameters[0], "expecting JSON value")
+	var value string
+	assertTrue(t, json.Unmarshal([]byte(err.Parameters[1]), &value) == nil, "expecting valid JSON")
+	assertTrue(t, strings.HasPrefix(value, "0x"), "expecting fmt representation")
+	assertEquals(t, 3, len(err.Notes), "expecting notes")
+	assertTrue(t, strings.HasPrefix(err.Notes[0], "parameter P1 cannot be marshalled (json: unsupported type: chan int)"),
+		"expecting marshalling failure")
+	assertTrue(t, strings.HasPrefix(err.Notes[2], "parameter P3 cannot be marshalled (panic: marshaller failure)"),
+		"expecting recovered panic")
+	assertTrue(t, strings.Contains(err.DebugReport(), "Notes:\n"+err.Notes[0]+"\n"), "expecting notes in the report")
+
+	err = err.WithField("callback", func() {})
+	assertTrue(t, strings.HasPrefix(err.Notes[3], "field callback cannot be marshalled"), "expecting field note")
+
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertEquals(t, err.Notes, recovered.(*GenericError).Notes, "expecting serialized notes")
+}
+
+func TestWithParamsCyclicValues(t *testing.T) {
+	node := &cyclicNode{Name: "n1"}
+	node.Next = node
+	err := NewInternalError("operation failed").WithParams(node)
+	var value string
+	assertTrue(t, json.Unmarshal([]byte(err.Parameters[0]), &value) == nil, "expecting valid JSON")
+	assertTrue(t, strings.HasPrefix(value, "&{Name:n1 Next:0x"), "expecting fmt representation")
+	assertTrue(t, strings.Contains(err.Notes[0], "encountered a cycle"), "expecting cycle note")
+
+	cyclicMap := map[string]interface{}{"name": "m1"}
+	cyclicMap["self"] = cyclicMap
+	cyclicSlice := make([]interface{}, 1)
+	cyclicSlice[0] = cyclicSlice
+	err = err.WithParams(cyclicMap, cyclicSlice)
+	assertEquals(t, `"map[string]interface {} (cyclic value)"`, err.Parameters[1], "expecting cyclic map")
+	assertEquals(t, `"[]interface {} (cyclic value)"`, err.Parameters[2], "expecting cyclic slice")
+	assertEquals(t, 3, len(err.Notes), "expecting notes")
+}
+
+func TestWithParamsLargeValues(t *testing.T) {
+	defer SetParameterSize(DefaultParameterSize)
+	SetParameterSize(100)
+	large := strings.Repeat("x", 500)
+	err := NewInternalError("operation failed").WithParams(large, "small").WithField("large", []string{large})
+	var value string
+	assertTrue(t, json.Unmarshal([]byte(err.Parameters[0]), &value) == nil, "expecting valid JSON")
+	assertEquals(t, `"`+strings.Repeat("x", 99)+"...", value, "expecting truncated value")
+	assertEquals(t, `"small"`, err.Parameters[1], "small values are not truncated")
+	assertEquals(t, []string{"parameter P0 truncated from 502 to 100 bytes",
+		"field large truncated from 504 to 100 bytes"}, err.Notes, "expecting truncation notes")
+	assertTrue(t, json.Valid(err.Fields["large"]), "expecting valid JSON")
+}
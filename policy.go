@@ -0,0 +1,198 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Policies applied when reporting stack traces.
+
+package derrors
+
+import (
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// LibraryPackages contains the standard library packages whose frames are usually not relevant to find the origin
+// of an error.
+var LibraryPackages = []string{"runtime", "net/http", "testing"}
+
+// StackPolicy structure that defines how the stack traces are reported. The policy is applied when the stack is
+// requested, so it affects StackTrace, StackTraceAsString, DebugReport and the JSON representation.
+type StackPolicy struct {
+	// TrimPaths reports the file paths relative to the module that contains them instead of the absolute build path.
+	TrimPaths bool
+	// HideOwnFrames removes the frames of the derrors packages.
+	HideOwnFrames bool
+	// HiddenPackages contains the packages whose frames are removed. Subpackages are also matched.
+	HiddenPackages []string
+	// CollapsedPackages contains the packages whose consecutive frames are replaced by a single entry reporting the
+	// number of omitted frames. Subpackages are also matched.
+	CollapsedPackages []string
+}
+
+// NewLibraryStackPolicy creates a policy that trims the file paths, hides the frames of the derrors package and
+// collapses the frames of the LibraryPackages.
+func NewLibraryStackPolicy() *StackPolicy {
+	return &StackPolicy{
+		TrimPaths:         true,
+		HideOwnFrames:     true,
+		CollapsedPackages: LibraryPackages,
+	}
+}
+
+// stackPolicy contains the policy applied to the stack traces.
+var stackPolicy atomic.Value
+
+// SetStackPolicy sets the policy applied to the stack traces. A nil policy reports the stack traces as captured.
+func SetStackPolicy(policy *StackPolicy) {
+	if policy == nil {
+		policy = &StackPolicy{}
+	}
+	copied := *policy
+	stackPolicy.Store(&copied)
+}
+
+// CurrentStackPolicy returns the policy applied to the stack traces.
+func CurrentStackPolicy() *StackPolicy {
+	if policy, ok := stackPolicy.Load().(*StackPolicy); ok {
+		return policy
+	}
+	return &StackPolicy{}
+}
+
+// isEmpty checks if the policy does not modify the stack traces.
+func (sp *StackPolicy) isEmpty() bool {
+	return !sp.TrimPaths && !sp.HideOwnFrames && len(sp.HiddenPackages) == 0 && len(sp.CollapsedPackages) == 0
+}
+
+// Apply returns the result of applying the policy to a stack trace. The given stack trace is not modified.
+func (sp *StackPolicy) Apply(stackTrace []StackEntry) []StackEntry {
+	if sp.isEmpty() || len(stackTrace) == 0 {
+		return stackTrace
+	}
+	result := make([]StackEntry, 0, len(stackTrace))
+	for _, entry := range stackTrace {
+		if entry.Omitted > 0 {
+			result = append(result, entry)
+			continue
+		}
+		pkg := packageName(entry.FunctionName)
+		if sp.HideOwnFrames && isOwnFrame(pkg, entry.File) || matchesPackage(pkg, sp.HiddenPackages) {
+			continue
+		}
+		if collapsed := matchingPackage(pkg, sp.CollapsedPackages); collapsed != "" {
+			last := len(result) - 1
+			if last >= 0 && result[last].Omitted > 0 && result[last].FunctionName == collapsed {
+				result[last].Omitted++
+			} else {
+				result = append(result, StackEntry{FunctionName: collapsed, Omitted: 1})
+			}
+			continue
+		}
+		if sp.TrimPaths {
+			entry.File = trimPath(pkg, entry.File)
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// packageName returns the package of a fully qualified function name.
+func packageName(functionName string) string {
+	lastSlash := strings.LastIndex(functionName, "/")
+	dot := strings.Index(functionName[lastSlash+1:], ".")
+	if dot < 0 {
+		return functionName
+	}
+	return functionName[:lastSlash+1+dot]
+}
+
+// matchesPackage checks if a package is any of the given packages or one of their subpackages.
+func matchesPackage(pkg string, packages []string) bool {
+	return matchingPackage(pkg, packages) != ""
+}
+
+// matchingPackage returns the first of the given packages that contains a package, or an empty string.
+func matchingPackage(pkg string, packages []string) string {
+	for _, candidate := range packages {
+		if pkg == candidate || strings.HasPrefix(pkg, candidate+"/") {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// ownPackage contains the name of the derrors package.
+var ownPackage = packageName(runtime.FuncForPC(reflect.ValueOf(newError).Pointer()).Name())
+
+// isOwnFrame checks if a frame belongs to the derrors packages. Test files are not considered part of the package.
+func isOwnFrame(pkg string, file string) bool {
+	return matchesPackage(pkg, []string{ownPackage}) && !strings.HasSuffix(file, "_test.go")
+}
+
+// moduleVersions contains the versions of the modules included in the binary.
+var moduleVersions struct {
+	once     sync.Once
+	versions map[string]string
+}
+
+// moduleVersion returns the module that contains a package and its version. The version is empty for the main
+// module and for packages that do not belong to a module, for which the module is the package itself.
+func moduleVersion(pkg string) (string, string) {
+	moduleVersions.once.Do(func() {
+		moduleVersions.versions = make(map[string]string)
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, dep := range info.Deps {
+				version := dep.Version
+				if dep.Replace != nil {
+					version = dep.Replace.Version
+				}
+				moduleVersions.versions[dep.Path] = version
+			}
+		}
+	})
+	// Select the longest match as modules may be nested.
+	resultModule, resultVersion := pkg, ""
+	matched := ""
+	for module, version := range moduleVersions.versions {
+		if (pkg == module || strings.HasPrefix(pkg, module+"/")) && len(module) > len(matched) {
+			matched = module
+			resultModule, resultVersion = module, version
+		}
+	}
+	return resultModule, resultVersion
+}
+
+// trimPath returns the path of a file relative to the module that contains it, following the format used by
+// the trimpath build flag: <package>/<file> for the main module and the standard library, and
+// <module>@<version>/<package path within the module>/<file> for dependencies. Paths that are not absolute are
+// returned as they are.
+func trimPath(pkg string, file string) string {
+	if pkg == "" || !path.IsAbs(file) && !filepath.IsAbs(file) {
+		return file
+	}
+	base := filepath.Base(file)
+	module, version := moduleVersion(pkg)
+	if version == "" {
+		return pkg + "/" + base
+	}
+	return module + "@" + version + strings.TrimPrefix(pkg, module) + "/" + base
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Stack policy tests
+
+package derrors
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPackageName(t *testing.T) {
+	assertEquals(t, "github.com/nalej/derrors", packageName("github.com/nalej/derrors.(*GenericError).CausedBy"),
+		"expecting package of method")
+	assertEquals(t, "net/http", packageName("net/http.(*conn).serve.func1"), "expecting package of closure")
+	assertEquals(t, "main", packageName("main.main"), "expecting main package")
+	assertEquals(t, "github.com/nalej/derrors", ownPackage, "expecting derrors package")
+}
+
+func TestStackPolicyApply(t *testing.T) {
+	stackTrace := []StackEntry{
+		{FunctionName: "github.com/nalej/derrors.newError", File: "/build/derrors/error.go", Line: 10},
+		{FunctionName: "github.com/nalej/derrors.TestX", File: "/build/derrors/error_test.go", Line: 20},
+		{FunctionName: "github.com/acme/app/internal/store.Find", File: "/build/app/internal/store/store.go", Line: 30},
+		{FunctionName: "github.com/acme/vendor.Call", File: "/build/vendor/call.go", Line: 40},
+		{FunctionName: "testing.tRunner", File: "/usr/local/go/src/testing/testing.go", Line: 50},
+		{FunctionName: "runtime.goexit", File: "/usr/local/go/src/runtime/asm_amd64.s", Line: 60},
+		{Omitted: 3},
+	}
+	policy := NewLibraryStackPolicy()
+	policy.HiddenPackages = []string{"github.com/acme/vendor"}
+	result := policy.Apply(stackTrace)
+	expected := []StackEntry{
+		{FunctionName: "github.com/nalej/derrors.TestX", File: "github.com/nalej/derrors/error_test.go", Line: 20},
+		{FunctionName: "github.com/acme/app/internal/store.Find", File: "github.com/acme/app/internal/store/store.go",
+			Line: 30},
+		{FunctionName: "testing", Omitted: 1},
+		{FunctionName: "runtime", Omitted: 1},
+		{Omitted: 3},
+	}
+	assertEquals(t, expected, result, "expecting policy to be applied")
+	assertEquals(t, "... 1 testing frames omitted", result[2].String(), "expecting collapsed marker")
+	assertEquals(t, "/build/derrors/error.go", stackTrace[0].File, "original stack must not be modified")
+	assertEquals(t, result, policy.Apply(result), "policy must be idempotent")
+	assertEquals(t, stackTrace, (&StackPolicy{}).Apply(stackTrace), "empty policy must not modify the stack")
+}
+
+func TestStackPolicyCollapse(t *testing.T) {
+	stackTrace := []StackEntry{
+		{FunctionName: "net/http.HandlerFunc.ServeHTTP", File: "/go/src/net/http/server.go", Line: 1},
+		{FunctionName: "net/http.serverHandler.ServeHTTP", File: "/go/src/net/http/server.go", Line: 2},
+		{FunctionName: "net/http.(*conn).serve", File: "/go/src/net/http/server.go", Line: 3},
+	}
+	policy := &StackPolicy{CollapsedPackages: LibraryPackages}
+	assertEquals(t, []StackEntry{{FunctionName: "net/http", Omitted: 3}}, policy.Apply(stackTrace),
+		"expecting consecutive frames to be collapsed")
+}
+
+func TestSetStackPolicy(t *testing.T) {
+	defer SetStackPolicy(nil)
+	err := NewInternalError("operation failed")
+	raw := err.StackTrace()
+	SetStackPolicy(NewLibraryStackPolicy())
+	filtered := err.StackTrace()
+	assertEquals(t, StackEntry{FunctionName: "testing", Omitted: 1}, filtered[1], "expecting collapsed frames")
+	assertEquals(t, "github.com/nalej/derrors/policy_test.go", filtered[0].File, "expecting trimmed path")
+	assertTrue(t, strings.Contains(err.DebugReport(), "github.com/nalej/derrors/policy_test.go"),
+		"expecting policy on the debug report")
+	assertEquals(t, filtered[0].String(), err.StackTraceAsString()[0], "expecting policy on the string stack")
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	assertTrue(t, !strings.Contains(string(data), "testing.tRunner"), "expecting policy on the JSON")
+
+	SetStackPolicy(nil)
+	assertEquals(t, raw, err.StackTrace(), "expecting original stack")
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Problem details for HTTP APIs as defined in RFC 9457 (previously RFC 7807).
+
+package derrors
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ProblemTypePrefix is the prefix of the problem type URI. The type is built appending the name of the error type.
+var ProblemTypePrefix = "urn:derrors:"
+
+// Problem structure that contains the problem details of an error. The elements of the error that are not part
+// of the standard members are transported as extension members.
+type Problem struct {
+	// Type is a URI that identifies the problem type.
+	Type string `json:"type"`
+	// Title contains a short summary of the problem type.
+	Title string `json:"title"`
+	// Status contains the HTTP status code.
+	Status int `json:"status"`
+	// Detail contains the error message.
+	Detail string `json:"detail,omitempty"`
+	// Instance is a URI that identifies the specific occurrence of the problem.
+	Instance string `json:"instance,omitempty"`
+	// ErrorType contains the name of the error type.
+	ErrorType string `json:"errorType,omitempty"`
+	// Parameters associated with the error.
+	Parameters []string `json:"parameters,omitempty"`
+	// Fields contains the named parameters associated with the error.
+	Fields map[string]json.RawMessage `json:"fields,omitempty"`
+	// Metadata contains the context values of the operation that created the error.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Causes contains the list of causes of the error.
+	Causes []Cause `json:"causes,omitempty"`
+}
+
+// ToProblem transforms an Error into a Problem. The instance identifies the occurrence of the error as returned by
+// InstanceID. The stack traces of the causes are never included, although their parameters are, so errors that
+// should not expose them must be sanitized first.
+func ToProblem(err Error) *Problem {
+	genericError := ToGenericError(err).Sanitize(false, true)
+	statusCode := ToHTTPStatus(err.Type())
+	return &Problem{
+		Type:       ProblemTypePrefix + ErrorTypeAsString(err.Type()),
+		Title:      ErrorTypeAsString(err.Type()),
+		Status:     statusCode,
+		Detail:     genericError.Message,
+		Instance:   genericError.InstanceID(),
+		ErrorType:  ErrorTypeAsString(err.Type()),
+		Parameters: genericError.Parameters,
+		Fields:     genericError.Fields,
+		Metadata:   genericError.Metadata,
+		Causes:     genericError.Causes,
+	}
+}
+
+// FromProblem unmarshalls a byte array with the JSON representation of a problem into an Error.
+func FromProblem(data []byte) (Error, error) {
+	problem := &Problem{}
+	if err := json.Unmarshal(data, problem); err != nil {
+		return nil, err
+	}
+	if problem.Type == "" && problem.Title == "" && problem.Status == 0 && problem.Detail == "" {
+		return nil, errors.New("empty problem document")
+	}
+	return problem.ToError(), nil
+}
+
+// ToError transforms the problem into an equivalent GenericError. The error type is obtained from the errorType
+// extension member, from the problem type or from the status code in that order. The problem title is used as
+// message if there is no detail, and the problem instance identifies the occurrence of the error.
+func (p *Problem) ToError() *GenericError {
+	errorType, exists := ErrorTypesValues[p.ErrorType]
+	if !exists {
+		errorType, exists = ErrorTypesValues[strings.TrimPrefix(p.Type, ProblemTypePrefix)]
+	}
+	if !exists {
+		errorType = FromHTTPStatus(p.Status)
+	}
+	message := p.Detail
+	if message == "" {
+		message = p.Title
+	}
+	result := &GenericError{
+		ErrorType:  errorType,
+		Message:    message,
+		Instance:   p.Instance,
+		Parameters: p.Parameters,
+		Fields:     p.Fields,
+		Metadata:   p.Metadata,
+		Causes:     p.Causes,
+		Stack:      make([]StackEntry, 0),
+	}
+	if result.Parameters == nil {
+		result.Parameters = make([]string, 0)
+	}
+	if result.Causes == nil {
+		result.Causes = make([]Cause, 0)
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Problem details tests
+
+package derrors
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestToProblem(t *testing.T) {
+	err := NewNotFoundError("entity not found", errors.New("no rows")).WithParams("id1")
+	problem := ToProblem(err)
+	assertEquals(t, "urn:derrors:NotFound", problem.Type, "expecting problem type")
+	assertEquals(t, "NotFound", problem.Title, "expecting problem title")
+	assertEquals(t, 404, problem.Status, "expecting problem status")
+	assertEquals(t, "entity not found", problem.Detail, "expecting problem detail")
+	assertEquals(t, err.InstanceID(), problem.Instance, "expecting instance identifier")
+	assertEquals(t, problem.Instance, ToProblem(err).Instance, "expecting stable instance identifier")
+
+	data, errSer := json.Marshal(problem)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromProblem(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertEquals(t, err.Error(), recovered.Error(), "expecting same error")
+	assertEquals(t, err.Parameters, recovered.(*GenericError).Parameters, "expecting parameters")
+	assertEquals(t, "no rows", recovered.(*GenericError).Causes[0].Foreign.Message, "expecting causes")
+	assertEquals(t, err.InstanceID(), recovered.(*GenericError).InstanceID(), "expecting instance identifier")
+}
+
+func TestToProblemSanitizesCauses(t *testing.T) {
+	err := NewInternalError("operation failed", NewNotFoundError("entity not found").WithParams("id1"))
+	problem := ToProblem(err)
+	assertEquals(t, 0, len(problem.Causes[0].Error.StackTrace()), "cause stack must not be exposed")
+	assertEquals(t, []string{`"id1"`}, problem.Causes[0].Error.Parameters, "expecting cause parameters")
+	assertTrue(t, len(err.Causes[0].Error.StackTrace()) > 0, "original cause must keep its stack")
+}
+
+func TestFromProblemOtherServices(t *testing.T) {
+	recovered, err := FromProblem([]byte(`{"type":"https://example.com/probs/out-of-credit",
+		"title":"You do not have enough credit.","status":403,"detail":"Your current balance is 30",
+		"balance":30}`))
+	assertTrue(t, err == nil, "deserialization must work")
+	assertEquals(t, "[PermissionDenied] Your current balance is 30", recovered.Error(), "expecting error")
+
+	recovered, err = FromProblem([]byte(`{"title":"Unexpected failure","status":502}`))
+	assertTrue(t, err == nil, "deserialization must work")
+	assertEquals(t, "[Unavailable] Unexpected failure", recovered.Error(), "expecting error from status")
+
+	recovered, err = FromProblem([]byte(`{"title":"Unexpected failure"}`))
+	assertTrue(t, err == nil, "deserialization must work")
+	assertEquals(t, "[Generic] Unexpected failure", recovered.Error(), "expecting generic error")
+
+	_, err = FromProblem([]byte(`{}`))
+	assertTrue(t, err != nil, "expecting error on empty problem")
+	_, err = FromProblem([]byte(`not json`))
+	assertTrue(t, err != nil, "expecting error on invalid problem")
+}
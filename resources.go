@@ -0,0 +1,191 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Snapshot of the resources of the process attached to the errors.
+
+package derrors
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// procRoot is the path where the proc filesystem is mounted.
+var procRoot = "/proc"
+
+// cgroupRoot is the path where the cgroup filesystem is mounted.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// unlimitedCgroupMemory is the threshold from which a cgroup v1 memory limit is considered as unlimited.
+const unlimitedCgroupMemory = 1 << 62
+
+// captureResources indicates if a snapshot of the resources is attached to the ResourceExhausted errors.
+var captureResources int32
+
+// SetCaptureResources enables or disables attaching a snapshot of the resources of the process to the
+// ResourceExhausted errors when they are created. Notice that reading the memory statistics stops the world.
+func SetCaptureResources(enabled bool) {
+	value := int32(0)
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&captureResources, value)
+}
+
+// CaptureResourcesEnabled checks if a snapshot of the resources is attached to the ResourceExhausted errors.
+func CaptureResourcesEnabled() bool {
+	return atomic.LoadInt32(&captureResources) == 1
+}
+
+// MemoryStats structure with the relevant values of runtime.MemStats.
+type MemoryStats struct {
+	// Sys is the total memory in bytes obtained from the operating system.
+	Sys uint64 `json:"sys"`
+	// HeapAlloc is the size in bytes of the allocated heap objects.
+	HeapAlloc uint64 `json:"heapAlloc"`
+	// HeapInuse is the size in bytes of the in-use heap spans.
+	HeapInuse uint64 `json:"heapInuse"`
+	// HeapObjects is the number of allocated heap objects.
+	HeapObjects uint64 `json:"heapObjects"`
+	// StackInuse is the size in bytes of the stack spans.
+	StackInuse uint64 `json:"stackInuse"`
+	// NextGC is the target heap size of the next GC cycle.
+	NextGC uint64 `json:"nextGC"`
+	// NumGC is the number of completed GC cycles.
+	NumGC uint32 `json:"numGC"`
+	// PauseTotalNs is the cumulative time in nanoseconds of the GC pauses.
+	PauseTotalNs uint64 `json:"pauseTotalNs"`
+}
+
+// ResourceSnapshot structure that contains the usage of the resources of the process when an error is created.
+type ResourceSnapshot struct {
+	// Memory contains the memory statistics of the runtime.
+	Memory MemoryStats `json:"memory"`
+	// Goroutines is the number of goroutines.
+	Goroutines int `json:"goroutines"`
+	// GOMAXPROCS is the number of threads that can execute Go code simultaneously.
+	GOMAXPROCS int `json:"gomaxprocs"`
+	// OpenFiles is the number of open file descriptors. It is only available on Linux.
+	OpenFiles int `json:"openFiles,omitempty"`
+	// CgroupMemoryLimit is the memory limit in bytes of the cgroup of the process, if any.
+	CgroupMemoryLimit uint64 `json:"cgroupMemoryLimit,omitempty"`
+	// CgroupMemoryUsage is the memory usage in bytes of the cgroup of the process, if known.
+	CgroupMemoryUsage uint64 `json:"cgroupMemoryUsage,omitempty"`
+}
+
+// CaptureResources returns a snapshot of the resources of the process.
+func CaptureResources() *ResourceSnapshot {
+	stats := &runtime.MemStats{}
+	runtime.ReadMemStats(stats)
+	result := &ResourceSnapshot{
+		Memory: MemoryStats{
+			Sys:          stats.Sys,
+			HeapAlloc:    stats.HeapAlloc,
+			HeapInuse:    stats.HeapInuse,
+			HeapObjects:  stats.HeapObjects,
+			StackInuse:   stats.StackInuse,
+			NextGC:       stats.NextGC,
+			NumGC:        stats.NumGC,
+			PauseTotalNs: stats.PauseTotalNs,
+		},
+		Goroutines: runtime.NumGoroutine(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		OpenFiles:  openFiles(),
+	}
+	result.CgroupMemoryLimit, result.CgroupMemoryUsage = cgroupMemory()
+	return result
+}
+
+// openFiles returns the number of open file descriptors, or 0 if it cannot be determined.
+func openFiles() int {
+	files, err := os.ReadDir(filepath.Join(procRoot, "self", "fd"))
+	if err != nil {
+		return 0
+	}
+	return len(files)
+}
+
+// cgroupMemory returns the memory limit and usage of the cgroup of the process, supporting both cgroup v1 and v2.
+// A value of 0 indicates that it is unlimited or unknown.
+func cgroupMemory() (uint64, uint64) {
+	content, err := os.ReadFile(filepath.Join(procRoot, "self", "cgroup"))
+	if err != nil {
+		return 0, 0
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		// 0::/system.slice/app.service for v2, 4:memory:/docker/1a2b for v1
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			return readCgroupValue(filepath.Join(cgroupRoot, parts[2]), "memory.max"),
+				readCgroupValue(filepath.Join(cgroupRoot, parts[2]), "memory.current")
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "memory" {
+				base := filepath.Join(cgroupRoot, "memory", parts[2])
+				return readCgroupValue(base, "memory.limit_in_bytes"), readCgroupValue(base, "memory.usage_in_bytes")
+			}
+		}
+	}
+	return 0, 0
+}
+
+// readCgroupValue reads a memory value of a cgroup. If the file is not found in the directory of the cgroup, as
+// happens in containers where the cgroup is mounted as the root, the file is read from the parent directories.
+func readCgroupValue(directory string, name string) uint64 {
+	for {
+		content, err := os.ReadFile(filepath.Join(directory, name))
+		if err == nil {
+			value, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+			if err != nil || value >= unlimitedCgroupMemory {
+				// max for v2
+				return 0
+			}
+			return value
+		}
+		if len(directory) <= len(cgroupRoot) {
+			return 0
+		}
+		directory = filepath.Dir(directory)
+	}
+}
+
+// String returns the string representation of a ResourceSnapshot.
+func (rs *ResourceSnapshot) String() string {
+	var buffer strings.Builder
+	buffer.WriteString("Resources:\n")
+	buffer.WriteString(fmt.Sprintf("\tGoroutines: %d, GOMAXPROCS: %d", rs.Goroutines, rs.GOMAXPROCS))
+	if rs.OpenFiles > 0 {
+		buffer.WriteString(fmt.Sprintf(", open files: %d", rs.OpenFiles))
+	}
+	buffer.WriteString("\n")
+	buffer.WriteString(fmt.Sprintf("\tMemory: sys %d, heap alloc %d, heap in use %d, heap objects %d, stack in use %d\n",
+		rs.Memory.Sys, rs.Memory.HeapAlloc, rs.Memory.HeapInuse, rs.Memory.HeapObjects, rs.Memory.StackInuse))
+	buffer.WriteString(fmt.Sprintf("\tGC: %d cycles, pause total %dns, next GC %d\n",
+		rs.Memory.NumGC, rs.Memory.PauseTotalNs, rs.Memory.NextGC))
+	if rs.CgroupMemoryLimit > 0 || rs.CgroupMemoryUsage > 0 {
+		buffer.WriteString(fmt.Sprintf("\tCgroup memory: usage %d, limit %d\n", rs.CgroupMemoryUsage, rs.CgroupMemoryLimit))
+	}
+	return buffer.String()
+}
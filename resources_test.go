@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Resource snapshot tests
+
+package derrors
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path string, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func withTestRoots(t *testing.T) (string, string) {
+	previousProc, previousCgroup := procRoot, cgroupRoot
+	t.Cleanup(func() {
+		procRoot, cgroupRoot = previousProc, previousCgroup
+	})
+	procRoot, cgroupRoot = filepath.Join(t.TempDir(), "proc"), filepath.Join(t.TempDir(), "cgroup")
+	return procRoot, cgroupRoot
+}
+
+func TestCgroupMemoryV2(t *testing.T) {
+	proc, cgroup := withTestRoots(t)
+	writeTestFile(t, filepath.Join(proc, "self", "cgroup"), "0::/system.slice/app.service\n")
+	writeTestFile(t, filepath.Join(cgroup, "system.slice", "app.service", "memory.max"), "536870912\n")
+	writeTestFile(t, filepath.Join(cgroup, "system.slice", "app.service", "memory.current"), "1048576\n")
+	limit, usage := cgroupMemory()
+	assertEquals(t, uint64(536870912), limit, "expecting memory limit")
+	assertEquals(t, uint64(1048576), usage, "expecting memory usage")
+
+	writeTestFile(t, filepath.Join(cgroup, "system.slice", "app.service", "memory.max"), "max\n")
+	limit, _ = cgroupMemory()
+	assertEquals(t, uint64(0), limit, "expecting unlimited memory")
+}
+
+func TestCgroupMemoryV1(t *testing.T) {
+	proc, cgroup := withTestRoots(t)
+	writeTestFile(t, filepath.Join(proc, "self", "cgroup"), "5:cpu,cpuacct:/\n4:memory:/docker/1a2b\n")
+	// The cgroup of the container is mounted as the root of the controller.
+	writeTestFile(t, filepath.Join(cgroup, "memory", "memory.limit_in_bytes"), "268435456\n")
+	writeTestFile(t, filepath.Join(cgroup, "memory", "memory.usage_in_bytes"), "2097152\n")
+	limit, usage := cgroupMemory()
+	assertEquals(t, uint64(268435456), limit, "expecting memory limit")
+	assertEquals(t, uint64(2097152), usage, "expecting memory usage")
+
+	writeTestFile(t, filepath.Join(cgroup, "memory", "memory.limit_in_bytes"), "9223372036854771712\n")
+	limit, _ = cgroupMemory()
+	assertEquals(t, uint64(0), limit, "expecting unlimited memory")
+}
+
+func TestCaptureResources(t *testing.T) {
+	assertTrue(t, NewResourceExhaustedError("quota exceeded").Resources == nil, "capture must be disabled by default")
+	defer SetCaptureResources(false)
+	SetCaptureResources(true)
+	assertTrue(t, NewInternalError("operation failed").Resources == nil, "only attached to ResourceExhausted errors")
+	err := NewResourceExhaustedError("quota exceeded")
+	assertTrue(t, err.Resources != nil, "expecting resources")
+	assertTrue(t, err.Resources.Goroutines > 0, "expecting goroutines")
+	assertTrue(t, err.Resources.GOMAXPROCS > 0, "expecting GOMAXPROCS")
+	assertTrue(t, err.Resources.Memory.HeapAlloc > 0, "expecting memory statistics")
+	assertTrue(t, strings.Contains(err.DebugReport(), "Resources:\n\tGoroutines: "), "expecting resources in the report")
+
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertEquals(t, err.Resources, recovered.(*GenericError).Resources, "expecting serialized resources")
+}
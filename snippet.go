@@ -0,0 +1,123 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Source code snippets included in the debug reports.
+
+package derrors
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxCachedSourceFiles is the maximum number of source files kept in memory.
+const maxCachedSourceFiles = 64
+
+// SnippetOptions structure that defines the source code snippets included in the debug reports.
+type SnippetOptions struct {
+	// Frames is the number of frames from the top of each stack trace that include a snippet.
+	Frames int
+	// ContextLines is the number of lines shown before and after the line of the frame.
+	ContextLines int
+}
+
+// snippetOptions contains the options of the source code snippets.
+var snippetOptions atomic.Value
+
+// SetSnippetOptions enables the source code snippets on the debug reports. The source files are read from the paths
+// of the stack entries, so snippets are only available where the sources are present, as on a developer machine,
+// and the paths are not trimmed by the StackPolicy. Frames whose sources are not available are reported without
+// snippet. A nil value disables the snippets.
+func SetSnippetOptions(options *SnippetOptions) {
+	if options == nil {
+		options = &SnippetOptions{}
+	}
+	copied := *options
+	snippetOptions.Store(&copied)
+}
+
+// CurrentSnippetOptions returns the options of the source code snippets.
+func CurrentSnippetOptions() *SnippetOptions {
+	if options, ok := snippetOptions.Load().(*SnippetOptions); ok {
+		return options
+	}
+	return &SnippetOptions{}
+}
+
+// sourceCache contains the lines of the source files that have been read. Files that cannot be read are stored
+// with a nil value so they are not read again.
+var sourceCache = struct {
+	sync.Mutex
+	files map[string][]string
+}{files: make(map[string][]string)}
+
+// sourceLines returns the lines of a source file.
+func sourceLines(file string) []string {
+	sourceCache.Lock()
+	defer sourceCache.Unlock()
+	if lines, exists := sourceCache.files[file]; exists {
+		return lines
+	}
+	var lines []string
+	if data, err := os.ReadFile(file); err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+	}
+	if len(sourceCache.files) >= maxCachedSourceFiles {
+		sourceCache.files = make(map[string][]string)
+	}
+	sourceCache.files[file] = lines
+	return lines
+}
+
+// Snippet returns the lines of source code around the line of the entry, marking the line of the entry. An empty
+// string is returned if the source is not available or the file is not a Go source file. Notice that the file of
+// the entry is read, so entries received from other processes should not be used.
+func (se *StackEntry) Snippet(contextLines int) string {
+	if se.Omitted > 0 || !strings.HasSuffix(se.File, ".go") || se.Line < 1 {
+		return ""
+	}
+	lines := sourceLines(se.File)
+	if se.Line > len(lines) {
+		return ""
+	}
+	first, last := se.Line-contextLines, se.Line+contextLines
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	width := len(fmt.Sprint(last))
+	var buffer bytes.Buffer
+	for line := first; line <= last; line++ {
+		marker := " "
+		if line == se.Line {
+			marker = ">"
+		}
+		buffer.WriteString(fmt.Sprintf("%s %*d | %s\n", marker, width, line, lines[line-1]))
+	}
+	return buffer.String()
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Source code snippet tests
+
+package derrors
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnippet(t *testing.T) {
+	entry := NewInternalError("operation failed").StackTrace()[0]
+	snippet := entry.Snippet(2)
+	lines := strings.Split(strings.TrimSuffix(snippet, "\n"), "\n")
+	assertEquals(t, 5, len(lines), "expecting context lines")
+	assertTrue(t, strings.HasPrefix(lines[2], ">"), "expecting marker on the line of the entry")
+	assertTrue(t, strings.Contains(lines[2], `NewInternalError("operation failed")`), "expecting source line")
+	assertTrue(t, strings.HasPrefix(lines[1], " "), "expecting context line without marker")
+
+	sourceCache.Lock()
+	_, cached := sourceCache.files[entry.File]
+	sourceCache.Unlock()
+	assertTrue(t, cached, "expecting file to be cached")
+
+	missing := NewStackEntry("main.main", "/nonexistent/main.go", 10)
+	assertEquals(t, "", missing.Snippet(2), "expecting no snippet without sources")
+	outOfRange := NewStackEntry(entry.FunctionName, entry.File, 1000000)
+	assertEquals(t, "", outOfRange.Snippet(2), "expecting no snippet out of the file")
+	assertEquals(t, "", NewOmittedStackEntry(3).Snippet(2), "expecting no snippet on omitted frames")
+}
+
+func TestDebugReportSnippets(t *testing.T) {
+	err := NewInternalError("operation failed")
+	assertTrue(t, !strings.Contains(err.DebugReport(), "> "), "snippets must be disabled by default")
+	defer SetSnippetOptions(nil)
+	SetSnippetOptions(&SnippetOptions{Frames: 1, ContextLines: 1})
+	report := err.DebugReport()
+	assertTrue(t, strings.Contains(report, "ST0: "+err.StackTrace()[0].String()+"\n"+err.StackTrace()[0].Snippet(1)),
+		"expecting snippet after the top frame")
+	assertEquals(t, 3, strings.Count(report, " | "), "expecting snippet only on the top frame")
+}
+
+func TestSnippetOnlyLocalSources(t *testing.T) {
+	defer SetSnippetOptions(nil)
+	SetSnippetOptions(&SnippetOptions{Frames: 2, ContextLines: 1})
+	file := filepath.Join(t.TempDir(), "secret.txt")
+	assertTrue(t, os.WriteFile(file, []byte("secret line\n"), 0600) == nil, "expecting file")
+	assertEquals(t, "", NewStackEntry("main.main", file, 1).Snippet(1), "expecting no snippet of other files")
+
+	remote := &GenericError{ErrorType: Internal, Message: "remote", Stack: []StackEntry{{"main.main", file, 1, 0}}}
+	assertTrue(t, !strings.Contains(remote.DebugReport(), "secret line"), "expecting no snippet of received files")
+
+	local := NewInternalError("operation failed")
+	data, errSer := json.Marshal(local)
+	assertTrue(t, errSer == nil, "serialization must work")
+	decoded, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertTrue(t, strings.Contains(local.DebugReport(), " | "), "expecting snippets of local errors")
+	assertTrue(t, !strings.Contains(decoded.DebugReport(), " | "), "expecting no snippets of decoded errors")
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Capture of the calling stack.
+
+package derrors
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultStackDepth is the default maximum number of frames captured on a calling stack.
+const DefaultStackDepth = 32
+
+// stackDepth contains the maximum number of frames captured on a calling stack.
+var stackDepth = int32(DefaultStackDepth)
+
+// SetStackDepth sets the maximum number of frames captured on the calling stack of new errors. The frames beyond
+// that depth are reported as omitted.
+func SetStackDepth(depth int) {
+	if depth < 1 {
+		depth = 1
+	}
+	atomic.StoreInt32(&stackDepth, int32(depth))
+}
+
+// StackDepth returns the maximum number of frames captured on the calling stack of new errors.
+func StackDepth() int {
+	return int(atomic.LoadInt32(&stackDepth))
+}
+
+// StackEntry structure that contains information about an element in the calling stack.
+type StackEntry struct {
+	// FunctionName of the calling function.
+	FunctionName string
+	// File where the function is located.
+	File string
+	// Line of the file where the function is located.
+	Line int
+	// Omitted contains the number of frames that are not reported. It is only set on entries that do not identify
+	// a function, marking the end of a truncated stack or a group of collapsed frames whose package is contained
+	// in FunctionName.
+	Omitted int `json:"Omitted,omitempty"`
+}
+
+// NewStackEntry creates a new stack entry for a function on a given file:line.
+func NewStackEntry(functionName string, file string, line int) *StackEntry {
+	return &StackEntry{FunctionName: functionName, File: file, Line: line}
+}
+
+// NewOmittedStackEntry creates a new stack entry marking a number of frames that were not captured.
+func NewOmittedStackEntry(omitted int) *StackEntry {
+	return &StackEntry{Omitted: omitted}
+}
+
+// String returns the string representation of an StackEntry.
+func (se *StackEntry) String() string {
+	if se.Omitted > 0 && se.FunctionName != "" {
+		return fmt.Sprintf("... %d %s frames omitted", se.Omitted, se.FunctionName)
+	}
+	if se.Omitted > 0 {
+		return fmt.Sprintf("... %d frames omitted", se.Omitted)
+	}
+	return fmt.Sprintf("%s - %s:%d", se.FunctionName, se.File, se.Line)
+}
+
+// isTruncated checks if a stack trace ends with a marker of frames that were not captured.
+func isTruncated(stackTrace []StackEntry) bool {
+	last := len(stackTrace) - 1
+	return last >= 0 && stackTrace[last].Omitted > 0 && stackTrace[last].FunctionName == ""
+}
+
+// GetStackTrace retrieves the calling stack and transform that information into an array of StackEntry. The
+// function calling GetStackTrace and GetStackTrace itself are not included.
+func GetStackTrace() []StackEntry {
+	return captureCallers(2).StackTrace()
+}
+
+// callers structure that contains the program counters of a calling stack. The program counters are symbolized
+// the first time the stack entries are requested, so errors that are discarded do not pay for it.
+type callers struct {
+	pcs     []uintptr
+	omitted int
+	once    sync.Once
+	entries []StackEntry
+}
+
+// captureCallers captures the program counters of the calling stack up to the configured depth. The skip parameter
+// is the number of callers to skip, with 0 identifying the caller of captureCallers.
+func captureCallers(skip int) *callers {
+	result := &callers{pcs: make([]uintptr, StackDepth())}
+	// Skip runtime.Callers and captureCallers.
+	count := runtime.Callers(skip+2, result.pcs)
+	result.pcs = result.pcs[:count]
+	if count == cap(result.pcs) {
+		result.omitted = countCallers(skip + 2 + count)
+	}
+	return result
+}
+
+// countCallers counts the number of callers of the calling stack skipping the first ones.
+func countCallers(skip int) int {
+	var pcs [64]uintptr
+	total := 0
+	for {
+		// Skip also countCallers.
+		count := runtime.Callers(skip+1+total, pcs[:])
+		total += count
+		if count < len(pcs) {
+			return total
+		}
+	}
+}
+
+// StackTrace returns the stack entries, symbolizing the program counters on the first call. Inlined functions are
+// reported as independent entries.
+func (c *callers) StackTrace() []StackEntry {
+	c.once.Do(func() {
+		c.entries = make([]StackEntry, 0, len(c.pcs)+1)
+		if len(c.pcs) > 0 {
+			frames := runtime.CallersFrames(c.pcs)
+			for {
+				frame, more := frames.Next()
+				c.entries = append(c.entries, *NewStackEntry(frame.Function, frame.File, frame.Line))
+				if !more {
+					break
+				}
+			}
+		}
+		if c.omitted > 0 {
+			c.entries = append(c.entries, *NewOmittedStackEntry(c.omitted))
+		}
+	})
+	return c.entries
+}
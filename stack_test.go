@@ -0,0 +1,204 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Stack capture tests
+
+package derrors
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLazyStackTrace(t *testing.T) {
+	err := NewNotFoundError("entity not found")
+	assertTrue(t, err.Stack == nil, "stack must not be symbolized on creation")
+	stackTrace := err.StackTrace()
+	assertTrue(t, len(stackTrace) > 0, "expecting stack")
+	assertTrue(t, strings.HasSuffix(stackTrace[0].FunctionName, "TestLazyStackTrace"), "expecting caller")
+	assertEquals(t, stackTrace, err.StackTrace(), "expecting same stack")
+
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertEquals(t, stackTrace, recovered.StackTrace(), "expecting serialized stack")
+}
+
+// inlinedNotFoundError is small enough to be inlined by the compiler.
+func inlinedNotFoundError() *GenericError {
+	return NewNotFoundError("entity not found")
+}
+
+func TestStackTraceInlinedFunctions(t *testing.T) {
+	stackTrace := inlinedNotFoundError().StackTrace()
+	assertTrue(t, strings.HasSuffix(stackTrace[0].FunctionName, ".inlinedNotFoundError"), "expecting inlined caller")
+	assertTrue(t, strings.HasSuffix(stackTrace[1].FunctionName, ".TestStackTraceInlinedFunctions"),
+		"expecting test function")
+}
+
+func recursiveError(depth int) *GenericError {
+	if depth > 0 {
+		return recursiveError(depth - 1)
+	}
+	return NewInternalError("recursion failed")
+}
+
+func TestStackTraceDepth(t *testing.T) {
+	defer SetStackDepth(DefaultStackDepth)
+	SetStackDepth(5)
+	assertEquals(t, 5, StackDepth(), "expecting new depth")
+	full := recursiveError(10)
+	SetStackDepth(DefaultStackDepth)
+	expected := len(recursiveError(10).StackTrace())
+
+	stackTrace := full.StackTrace()
+	assertEquals(t, 6, len(stackTrace), "expecting truncated stack")
+	last := stackTrace[len(stackTrace)-1]
+	assertEquals(t, expected-5, last.Omitted, "expecting omitted frames")
+	assertEquals(t, fmt.Sprintf("... %d frames omitted", expected-5), last.String(), "expecting omitted marker")
+	assertTrue(t, strings.Contains(full.DebugReport(), "frames omitted"), "expecting marker in the report")
+
+	data, errSer := json.Marshal(full)
+	assertTrue(t, errSer == nil, "serialization must work")
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertEquals(t, stackTrace, recovered.StackTrace(), "expecting omitted marker to be serialized")
+}
+
+func newHelperError(msg string) *GenericError {
+	return NewErrorWithCallerSkip(1, Internal, msg)
+}
+
+func TestNewErrorWithCallerSkip(t *testing.T) {
+	stackTrace := newHelperError("helper error").StackTrace()
+	assertTrue(t, strings.HasSuffix(stackTrace[0].FunctionName, ".TestNewErrorWithCallerSkip"),
+		"helper must not appear in the stack")
+	stackTrace = NewErrorWithCallerSkip(0, Internal, "msg").StackTrace()
+	assertTrue(t, strings.HasSuffix(stackTrace[0].FunctionName, ".TestNewErrorWithCallerSkip"),
+		"expecting caller")
+}
+
+// benchmarkDepth is the depth of the calling stack used on the benchmarks to simulate an application.
+const benchmarkDepth = 16
+
+// findEntity simulates a lookup that fails at a given depth of the calling stack.
+func findEntity(depth int, constructor func(msg string, causes ...error) *GenericError) Error {
+	if depth > 0 {
+		return findEntity(depth-1, constructor)
+	}
+	return constructor("entity not found")
+}
+
+// newEagerNotFoundError creates an error symbolizing the stack on creation as previous versions did.
+func newEagerNotFoundError(msg string, causes ...error) *GenericError {
+	return &GenericError{
+		ErrorType:  NotFound,
+		Message:    msg,
+		Parameters: make([]string, 0),
+		Causes:     ErrorsToCauses(causes),
+		Stack:      GetStackTrace(),
+	}
+}
+
+// BenchmarkNewEagerNotFoundError measures the creation of an error symbolizing the stack on creation.
+func BenchmarkNewEagerNotFoundError(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := findEntity(benchmarkDepth, newEagerNotFoundError); err.Type() != NotFound {
+			b.Fatal("expecting not found")
+		}
+	}
+}
+
+// BenchmarkNewNotFoundError measures the creation of an error that is only checked by type.
+func BenchmarkNewNotFoundError(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := findEntity(benchmarkDepth, NewNotFoundError); err.Type() != NotFound {
+			b.Fatal("expecting not found")
+		}
+	}
+}
+
+// BenchmarkNewNotFoundErrorStackTrace measures the creation of an error whose stack is requested.
+func BenchmarkNewNotFoundErrorStackTrace(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = findEntity(benchmarkDepth, NewNotFoundError).StackTrace()
+	}
+}
+
+func newParentError() *GenericError {
+	return NewUnavailableError("cannot connect")
+}
+
+func TestDebugReportCommonFrames(t *testing.T) {
+	parent := newParentError()
+	err := NewInternalError("operation failed").CausedBy(parent)
+	stackTrace := err.StackTrace()
+	common := len(stackTrace) - 1
+	assertEquals(t, common, err.commonFramesWithParent(), "expecting frames below the test to be common")
+
+	report := err.DebugReport()
+	assertTrue(t, strings.Contains(report, fmt.Sprintf("... %d more frames in common with parent", common)),
+		"expecting elided frames")
+	assertEquals(t, 1, strings.Count(report, stackTrace[len(stackTrace)-1].String()),
+		"expecting common frames to be reported once")
+	assertTrue(t, strings.Contains(report, parent.StackToString()), "expecting full parent stack")
+	assertEquals(t, len(stackTrace)+1, strings.Count(err.StackToString(), "\n"), "expecting full stack")
+}
+
+func TestDebugReportNoCommonFrames(t *testing.T) {
+	parent := &GenericError{ErrorType: Internal, Message: "remote", Stack: []StackEntry{{"remote.Main", "main.go", 1, 0}}}
+	err := NewInternalError("operation failed").CausedBy(parent)
+	assertEquals(t, 0, err.commonFramesWithParent(), "expecting no common frames")
+
+	defer SetStackDepth(DefaultStackDepth)
+	SetStackDepth(1)
+	err = NewInternalError("operation failed").CausedBy(NewInternalError("truncated parent"))
+	assertEquals(t, 0, err.commonFramesWithParent(), "truncated stacks must not be compared")
+}
+
+func TestDebugReportCommonFramesOtherGoroutine(t *testing.T) {
+	result := make(chan *GenericError)
+	go func() {
+		result <- newParentError()
+	}()
+	err := NewInternalError("operation failed").CausedBy(<-result)
+	assertEquals(t, 0, err.commonFramesWithParent(), "runtime frames of other goroutines must not be common")
+	assertTrue(t, !strings.Contains(err.DebugReport(), "in common with parent"), "expecting no elided frames")
+
+	defer SetCaptureGoroutine(false)
+	SetCaptureGoroutine(true)
+	parent := newParentError()
+	parent.Goroutine = &GoroutineInfo{ID: parent.Goroutine.ID + 1}
+	err = NewInternalError("operation failed").CausedBy(parent)
+	assertEquals(t, 0, err.commonFramesWithParent(), "errors of other goroutines must not be compared")
+}
+
+func TestDebugReportCommonFramesRemote(t *testing.T) {
+	parent := newParentError()
+	data, errSer := json.Marshal(parent)
+	assertTrue(t, errSer == nil, "serialization must work")
+	remote, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	err := NewInternalError("operation failed").CausedBy(remote)
+	assertEquals(t, 0, err.commonFramesWithParent(), "decoded parents must not be compared")
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Serialization of stack traces as program counters and offline symbolization.
+
+package derrors
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/gosym"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// StackEncoding defines how the stack traces are serialized.
+type StackEncoding int
+
+const (
+	// SymbolizedStack serializes the stack traces as StackEntry elements.
+	SymbolizedStack StackEncoding = iota + 1
+	// ProgramCounterStack serializes the stack traces as raw program counters together with the build ID of the
+	// binary. The stack traces can be restored with Symbolize.
+	ProgramCounterStack
+)
+
+// stackEncoding contains the encoding used to serialize the stack traces.
+var stackEncoding = int32(SymbolizedStack)
+
+// SetStackEncoding sets the encoding used to serialize the stack traces of new and existing errors. Notice that
+// only the errors created on the current process can be serialized as program counters.
+func SetStackEncoding(encoding StackEncoding) {
+	atomic.StoreInt32(&stackEncoding, int32(encoding))
+}
+
+// CurrentStackEncoding returns the encoding used to serialize the stack traces.
+func CurrentStackEncoding() StackEncoding {
+	return StackEncoding(atomic.LoadInt32(&stackEncoding))
+}
+
+// RawStack structure that contains a calling stack as program counters so it can be symbolized offline.
+type RawStack struct {
+	// BuildID of the binary that captured the stack.
+	BuildID string `json:"buildID"`
+	// AnchorFunction contains the name of a function used to relocate the program counters.
+	AnchorFunction string `json:"anchorFunction"`
+	// Anchor contains the address of the anchor function on the process that captured the stack.
+	Anchor uint64 `json:"anchor"`
+	// PCs contains the program counters of the calling stack.
+	PCs []uint64 `json:"pcs"`
+	// Omitted contains the number of frames that were not captured.
+	Omitted int `json:"omitted,omitempty"`
+}
+
+// anchorPC contains the address of the function used to relocate the program counters.
+var anchorPC = reflect.ValueOf(newError).Pointer()
+
+// RawStack returns the captured calling stack as program counters.
+func (c *callers) RawStack() *RawStack {
+	pcs := make([]uint64, len(c.pcs))
+	for i, pc := range c.pcs {
+		pcs[i] = uint64(pc)
+	}
+	return &RawStack{
+		BuildID:        BuildID(),
+		AnchorFunction: runtime.FuncForPC(anchorPC).Name(),
+		Anchor:         uint64(anchorPC),
+		PCs:            pcs,
+		Omitted:        c.omitted,
+	}
+}
+
+// String returns the string representation of a RawStack.
+func (rs *RawStack) String() string {
+	return fmt.Sprintf("%d program counters pending symbolization with build ID %s", len(rs.PCs), rs.BuildID)
+}
+
+// buildID contains the build ID of the current binary.
+var buildID struct {
+	once sync.Once
+	id   string
+}
+
+// BuildID returns the Go build ID of the current binary, or an empty string if it cannot be read.
+func BuildID() string {
+	buildID.once.Do(func() {
+		path, err := os.Executable()
+		if err != nil {
+			return
+		}
+		file, err := elf.Open(path)
+		if err != nil {
+			return
+		}
+		defer file.Close()
+		buildID.id, _ = readBuildID(file)
+	})
+	return buildID.id
+}
+
+// readBuildID reads the Go build ID from the notes of an ELF file.
+func readBuildID(file *elf.File) (string, error) {
+	section := file.Section(".note.go.buildid")
+	if section == nil {
+		return "", errors.New("binary does not contain a Go build ID")
+	}
+	data, err := section.Data()
+	if err != nil {
+		return "", err
+	}
+	// The note contains the name size, the description size and the type followed by the name and description.
+	if len(data) < 16 {
+		return "", errors.New("invalid Go build ID note")
+	}
+	nameSize := file.ByteOrder.Uint32(data[0:4])
+	descriptionSize := file.ByteOrder.Uint32(data[4:8])
+	start := 12 + (uint64(nameSize)+3)&^3
+	end := start + uint64(descriptionSize)
+	if end > uint64(len(data)) || !bytes.HasPrefix(data[12:], []byte("Go")) {
+		return "", errors.New("invalid Go build ID note")
+	}
+	return string(data[start:end]), nil
+}
+
+// Symbolize restores the stack traces of an error chain serialized as program counters using the binary that
+// created the errors. The binary must be an ELF file with the same build ID. A copy of the error is returned with
+// the stack entries restored. Notice that functions inlined by the compiler are reported as their caller.
+func Symbolize(err Error, binaryPath string) (Error, error) {
+	if err == nil {
+		return nil, nil
+	}
+	file, openErr := elf.Open(binaryPath)
+	if openErr != nil {
+		return nil, openErr
+	}
+	defer file.Close()
+	id, idErr := readBuildID(file)
+	if idErr != nil {
+		return nil, idErr
+	}
+	table, tableErr := readSymbolTable(file)
+	if tableErr != nil {
+		return nil, tableErr
+	}
+	return (&symbolizer{id, table}).symbolize(ToGenericError(err))
+}
+
+// readSymbolTable reads the Go symbol table of an ELF file.
+func readSymbolTable(file *elf.File) (*gosym.Table, error) {
+	pclntab := file.Section(".gopclntab")
+	text := file.Section(".text")
+	if pclntab == nil || text == nil {
+		return nil, errors.New("binary does not contain a Go symbol table")
+	}
+	data, err := pclntab.Data()
+	if err != nil {
+		return nil, err
+	}
+	return gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr))
+}
+
+// symbolizer structure that restores the stack traces of an error chain.
+type symbolizer struct {
+	buildID string
+	table   *gosym.Table
+}
+
+// symbolize returns a copy of the error with the stack traces of the chain restored.
+func (s *symbolizer) symbolize(ge *GenericError) (*GenericError, error) {
+	result := *ge
+	if ge.RawStack != nil {
+		stackTrace, err := s.stackTrace(ge.RawStack)
+		if err != nil {
+			return nil, err
+		}
+		result.Stack = stackTrace
+		result.RawStack = nil
+	}
+	result.Causes = make([]Cause, len(ge.Causes))
+	for i, cause := range ge.Causes {
+		result.Causes[i] = cause
+		if cause.Error != nil {
+			symbolized, err := s.symbolize(cause.Error)
+			if err != nil {
+				return nil, err
+			}
+			result.Causes[i] = cause.withError(symbolized)
+		}
+	}
+	if !isNilError(ge.Parent) {
+		parent, err := s.symbolize(ToGenericError(ge.Parent))
+		if err != nil {
+			return nil, err
+		}
+		result.Parent = parent
+	}
+	return &result, nil
+}
+
+// stackTrace restores the stack entries of a raw stack.
+func (s *symbolizer) stackTrace(rawStack *RawStack) ([]StackEntry, error) {
+	if rawStack.BuildID != s.buildID {
+		return nil, fmt.Errorf("build ID mismatch: stack captured by %s, binary is %s", rawStack.BuildID, s.buildID)
+	}
+	// Relocate the program counters in case the binary was loaded on a different address.
+	var offset uint64
+	if anchor := s.table.LookupFunc(rawStack.AnchorFunction); anchor != nil {
+		offset = rawStack.Anchor - anchor.Entry
+	}
+	result := make([]StackEntry, 0, len(rawStack.PCs)+1)
+	for _, pc := range rawStack.PCs {
+		// The program counters are return addresses, so the call instruction is the previous one.
+		file, line, function := s.table.PCToLine(pc - offset - 1)
+		if function == nil {
+			result = append(result, *NewStackEntry(fmt.Sprintf("unknown pc 0x%x", pc), "", 0))
+			continue
+		}
+		result = append(result, *NewStackEntry(function.Name, file, line))
+	}
+	if rawStack.Omitted > 0 {
+		result = append(result, *NewOmittedStackEntry(rawStack.Omitted))
+	}
+	return result, nil
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Offline symbolization tests
+
+package derrors
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+//go:noinline
+func newSymbolizedError() *GenericError {
+	return NewNotFoundError("entity not found")
+}
+
+func TestSymbolize(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("symbolization requires an ELF binary")
+	}
+	assertTrue(t, BuildID() != "", "expecting build ID")
+	defer SetStackEncoding(SymbolizedStack)
+	SetStackEncoding(ProgramCounterStack)
+	parent := newSymbolizedError()
+	err := NewInternalError("operation failed", newSymbolizedError()).CausedBy(parent)
+	data, errSer := json.Marshal(err)
+	assertTrue(t, errSer == nil, "serialization must work")
+	assertTrue(t, !strings.Contains(string(data), "newSymbolizedError"), "expecting no symbols")
+
+	recovered, errDes := FromJSON(data)
+	assertTrue(t, errDes == nil, "deserialization must work")
+	assertEquals(t, 0, len(recovered.StackTrace()), "expecting stack pending symbolization")
+	assertTrue(t, strings.Contains(recovered.DebugReport(), "pending symbolization"), "expecting raw stack")
+
+	binaryPath, errPath := os.Executable()
+	assertTrue(t, errPath == nil, "expecting binary path")
+	symbolized, errSym := Symbolize(recovered, binaryPath)
+	assertTrue(t, errSym == nil, "symbolization must work")
+	assertEquals(t, err.StackTrace(), symbolized.StackTrace(), "expecting restored stack")
+	symbolizedError := symbolized.(*GenericError)
+	assertEquals(t, parent.StackTrace(), symbolizedError.Parent.StackTrace(), "expecting restored parent stack")
+	assertEquals(t, err.Causes[0].Error.StackTrace(), symbolizedError.Causes[0].Error.StackTrace(),
+		"expecting restored cause stack")
+	assertTrue(t, recovered.(*GenericError).RawStack != nil, "original error must not be modified")
+}
+
+func TestSymbolizeBuildIDMismatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("symbolization requires an ELF binary")
+	}
+	err := NewInternalError("operation failed")
+	err.RawStack = &RawStack{BuildID: "other", PCs: []uint64{1}}
+	binaryPath, _ := os.Executable()
+	_, errSym := Symbolize(err, binaryPath)
+	assertTrue(t, errSym != nil && strings.Contains(errSym.Error(), "build ID mismatch"), "expecting mismatch")
+	_, errSym = Symbolize(err, "/nonexistent/binary")
+	assertTrue(t, errSym != nil, "expecting error on missing binary")
+}
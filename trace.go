@@ -0,0 +1,84 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Integration of the errors with the execution traces of runtime/trace.
+
+package derrors
+
+import (
+	"context"
+	"errors"
+	"runtime/trace"
+	"sync/atomic"
+)
+
+// TraceCategoryPrefix is the prefix of the category of the trace events, followed by the name of the error type.
+const TraceCategoryPrefix = "derrors."
+
+// traceErrors indicates if the errors are logged into the execution trace when they are created.
+var traceErrors int32
+
+// SetTraceErrors enables or disables logging the errors into the execution trace when they are created. The events
+// are only emitted while a trace is being collected. Errors created with NewErrorCtx are logged in the task of
+// their context.
+func SetTraceErrors(enabled bool) {
+	value := int32(0)
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&traceErrors, value)
+}
+
+// TraceErrorsEnabled checks if the errors are logged into the execution trace when they are created.
+func TraceErrorsEnabled() bool {
+	return atomic.LoadInt32(&traceErrors) == 1
+}
+
+// Record logs an error into the execution trace within the task of the context. The category of the event is the
+// name of the error type prefixed by TraceCategoryPrefix, with errors that are not derrors errors logged as
+// Generic, and the message is the error message. It does nothing if no trace is being collected.
+func Record(ctx context.Context, err error) {
+	if err == nil || !trace.IsEnabled() {
+		return
+	}
+	var genericError *GenericError
+	if errors.As(err, &genericError) {
+		traceError(ctx, genericError)
+		return
+	}
+	errorType := Generic
+	var derror Error
+	if errors.As(err, &derror) {
+		errorType = derror.Type()
+	}
+	trace.Log(contextOrBackground(ctx), TraceCategoryPrefix+ErrorTypeAsString(errorType), err.Error())
+}
+
+// traceError logs a GenericError into the execution trace.
+func traceError(ctx context.Context, err *GenericError) {
+	if trace.IsEnabled() {
+		trace.Log(contextOrBackground(ctx), TraceCategoryPrefix+ErrorTypeAsString(err.ErrorType), err.Message)
+	}
+}
+
+// contextOrBackground returns the context or the background context if it is nil.
+func contextOrBackground(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Execution trace tests
+
+package derrors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime/trace"
+	"testing"
+)
+
+func collectTrace(t *testing.T, function func(ctx context.Context)) []byte {
+	var buffer bytes.Buffer
+	if err := trace.Start(&buffer); err != nil {
+		t.Skipf("cannot start the trace: %s", err.Error())
+	}
+	ctx, task := trace.NewTask(context.Background(), "operation")
+	function(ctx)
+	task.End()
+	trace.Stop()
+	return buffer.Bytes()
+}
+
+func TestTraceErrors(t *testing.T) {
+	data := collectTrace(t, func(ctx context.Context) {
+		NewInternalError("untraced failure")
+	})
+	assertTrue(t, !bytes.Contains(data, []byte("untraced failure")), "tracing must be disabled by default")
+
+	defer SetTraceErrors(false)
+	SetTraceErrors(true)
+	data = collectTrace(t, func(ctx context.Context) {
+		NewErrorCtx(ctx, Internal, "traced failure")
+		NewUnavailableError("traced without context")
+	})
+	assertTrue(t, bytes.Contains(data, []byte(TraceCategoryPrefix+"Internal")), "expecting error type category")
+	assertTrue(t, bytes.Contains(data, []byte("traced failure")), "expecting error message")
+	assertTrue(t, bytes.Contains(data, []byte(TraceCategoryPrefix+"Unavailable")), "expecting error type category")
+	assertTrue(t, bytes.Contains(data, []byte("traced without context")), "expecting error message")
+}
+
+func TestRecord(t *testing.T) {
+	Record(context.Background(), NewNotFoundError("ignored without trace"))
+	data := collectTrace(t, func(ctx context.Context) {
+		Record(ctx, NewNotFoundError("entity not found"))
+		Record(ctx, errors.New("plain failure"))
+		Record(ctx, nil)
+	})
+	assertTrue(t, bytes.Contains(data, []byte(TraceCategoryPrefix+"NotFound")), "expecting error type category")
+	assertTrue(t, bytes.Contains(data, []byte("entity not found")), "expecting error message")
+	assertTrue(t, bytes.Contains(data, []byte(TraceCategoryPrefix+"Generic")), "expecting generic category")
+	assertTrue(t, bytes.Contains(data, []byte("plain failure")), "expecting error message")
+}
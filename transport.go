@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// HTTP client transport that transforms failures into derrors errors.
+
+package derrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// MaxErrorBodySize is the maximum number of bytes of an error response that are read by the Transport.
+var MaxErrorBodySize int64 = 1 << 20
+
+// Transport structure that wraps an http.RoundTripper transforming transport failures and error responses into
+// derrors errors. Notice that unlike a plain http.RoundTripper, an error is returned for responses with a 4xx or 5xx
+// status code. Other status codes, including redirections and 304 Not Modified, are returned as responses. The
+// http.Client wraps the errors of the Transport in a *url.Error, so callers obtain the derrors Error with errors.As.
+type Transport struct {
+	// Base RoundTripper used to perform the requests. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+}
+
+// NewTransport creates a new Transport wrapping a given RoundTripper.
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{base}
+}
+
+// RoundTrip executes a single HTTP transaction. Transport failures are classified as Canceled, DeadlineExceeded
+// or Unavailable errors, and error responses are decoded linking the remote error as parent. The method, URL and
+// status code are added as parameters.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	url := req.URL.Redacted()
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, NewError(classifyTransportError(err), fmt.Sprintf("%s %s failed", req.Method, url), err).
+			WithParams(req.Method, url)
+	}
+	if resp.StatusCode < http.StatusBadRequest {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, MaxErrorBodySize))
+	remote := decodeErrorResponse(resp, body)
+	return nil, NewError(remote.Type(), fmt.Sprintf("%s %s returned %s", req.Method, url, resp.Status)).
+		WithParams(req.Method, url, resp.StatusCode).CausedBy(remote)
+}
+
+// classifyTransportError returns the error type associated with an error obtained performing a request.
+func classifyTransportError(err error) ErrorType {
+	if errors.Is(err, context.Canceled) {
+		return Canceled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return DeadlineExceeded
+	}
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return DeadlineExceeded
+	}
+	// Dial, DNS, TLS and connection failures.
+	return Unavailable
+}
+
+// decodeErrorResponse decodes the body of an error response. Bodies containing a derrors error or a problem
+// document are decoded, any other body is used as the message of an error whose type is obtained from the
+// status code.
+func decodeErrorResponse(resp *http.Response, body []byte) Error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case ProblemMediaType:
+		if remote, err := FromProblem(body); err == nil {
+			return remote
+		}
+	case JSONMediaType:
+		if remote, err := FromJSON(body); err == nil {
+			return remote
+		}
+	}
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return &GenericError{
+		ErrorType:  FromHTTPStatus(resp.StatusCode),
+		Message:    message,
+		Parameters: make([]string, 0),
+		Causes:     make([]Cause, 0),
+		Stack:      make([]StackEntry, 0),
+	}
+}
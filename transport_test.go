@@ -0,0 +1,115 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// HTTP client transport tests
+
+package derrors
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func transportGet(t *testing.T, url string, ctx context.Context) (*http.Response, Error) {
+	client := &http.Client{Transport: NewTransport(nil)}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	assertTrue(t, err == nil, "expecting request")
+	resp, err := client.Do(request)
+	if err != nil {
+		var derror Error
+		assertTrue(t, errors.As(err, &derror), "expecting derrors error")
+		return nil, derror
+	}
+	return resp, nil
+}
+
+func TestTransportSuccess(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+	resp, err := transportGet(t, server.URL, context.Background())
+	assertTrue(t, err == nil, "expecting no error")
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assertEquals(t, "ok", string(body), "expecting body")
+}
+
+func TestTransportDerrorsResponse(t *testing.T) {
+	server := httptest.NewServer(NewErrorHandler(notFoundHandler, false, true))
+	defer server.Close()
+	_, err := transportGet(t, server.URL+"/entity", context.Background())
+	assertEquals(t, NotFound, err.Type(), "expecting error type")
+	genericError := err.(*GenericError)
+	assertEquals(t, []string{`"GET"`, `"` + server.URL + `/entity"`, "404"}, genericError.Parameters,
+		"expecting request parameters")
+	parent := genericError.Parent.(*GenericError)
+	assertEquals(t, "[NotFound] entity not found", parent.Error(), "expecting remote error")
+	assertEquals(t, []string{`"id1"`}, parent.Parameters, "expecting remote parameters")
+}
+
+func TestTransportProblemResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ProblemMediaType)
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"type":"about:blank","title":"Forbidden","status":403,"detail":"not allowed"}`)
+	}))
+	defer server.Close()
+	_, err := transportGet(t, server.URL, context.Background())
+	assertEquals(t, PermissionDenied, err.Type(), "expecting error type")
+	assertEquals(t, "[PermissionDenied] not allowed", err.(*GenericError).Parent.Error(), "expecting remote error")
+}
+
+func TestTransportTextResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "service overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	_, err := transportGet(t, server.URL, context.Background())
+	assertEquals(t, Unavailable, err.Type(), "expecting error type")
+	assertTrue(t, strings.HasSuffix(err.Error(), "returned 503 Service Unavailable"), "expecting status")
+	assertEquals(t, "[Unavailable] service overloaded", err.(*GenericError).Parent.Error(), "expecting body")
+}
+
+func TestTransportFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := transportGet(t, server.URL, ctx)
+	assertEquals(t, DeadlineExceeded, err.Type(), "expecting deadline exceeded")
+	assertTrue(t, errors.Is(err, context.DeadlineExceeded), "expecting original cause")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = transportGet(t, server.URL, ctx)
+	assertEquals(t, Canceled, err.Type(), "expecting canceled")
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	_, err = transportGet(t, closed.URL, context.Background())
+	assertEquals(t, Unavailable, err.Type(), "expecting unavailable")
+}